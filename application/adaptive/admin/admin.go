@@ -0,0 +1,100 @@
+// Package admin exposes the kill switch and the forced ratios of the limiting package over http, for incidents
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+)
+
+type State struct {
+	Disabled  bool       `json:"disabled"`
+	Overrides []Override `json:"overrides"`
+	Limiters  []string   `json:"limiters"`
+}
+
+type Override struct {
+	Name    string    `json:"name"`
+	Ratio   float64   `json:"ratio"`
+	Expires time.Time `json:"expires"`
+}
+
+type errorView struct {
+	Error string `json:"error"`
+}
+
+// Handler serves the State on GET, and the actions on POST to the paths ending with
+//
+//	/disable                              limiting.DisableAll
+//	/enable                               limiting.EnableAll
+//	/force?name=api&ratio=5000&ttl=10m    limiting.ForceRatio, ratio is 0 ~ 10000
+//	/clear?name=api                       limiting.ClearRatio
+//
+// eg. http.Handle("/debug/plato/admin/", admin.Handler()). It should only be reachable by operators
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if r.Method == http.MethodGet {
+			write(w, http.StatusOK, snapshot())
+			return
+		}
+		if r.Method != http.MethodPost {
+			write(w, http.StatusMethodNotAllowed, errorView{Error: "method not allowed"})
+			return
+		}
+		var err error
+		switch action {
+		case "disable":
+			limiting.DisableAll()
+		case "enable":
+			limiting.EnableAll()
+		case "force":
+			err = force(r)
+		case "clear":
+			limiting.ClearRatio(r.FormValue("name"))
+		default:
+			write(w, http.StatusNotFound, errorView{Error: "unknown action " + strconv.Quote(action)})
+			return
+		}
+		if err != nil {
+			write(w, http.StatusBadRequest, errorView{Error: err.Error()})
+			return
+		}
+		write(w, http.StatusOK, snapshot())
+	})
+}
+
+func force(r *http.Request) error {
+	ratio, err := strconv.ParseFloat(r.FormValue("ratio"), 64)
+	if err != nil {
+		return err
+	}
+	ttl, err := time.ParseDuration(r.FormValue("ttl"))
+	if err != nil {
+		return err
+	}
+	return limiting.ForceRatio(r.FormValue("name"), ratio, ttl)
+}
+
+func snapshot() State {
+	s := State{Disabled: limiting.AllDisabled(), Overrides: []Override{}, Limiters: []string{}}
+	for _, o := range limiting.Overrides() {
+		s.Overrides = append(s.Overrides, Override{Name: o.Name, Ratio: o.Ratio, Expires: o.Expires})
+	}
+	for _, nl := range limiting.Limiters() {
+		s.Limiters = append(s.Limiters, nl.Name)
+	}
+	return s
+}
+
+func write(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
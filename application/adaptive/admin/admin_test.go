@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bytedance/pid_limits/application/adaptive/config"
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, method, target string) (int, State) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	var s State
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &s))
+	}
+	return rec.Code, s
+}
+
+func TestHandler(t *testing.T) {
+	limiting.NewPidLimiting(1, 2, 3, 0.8, config.WithName("admin-api"), config.WithDisableMetric(), config.WithRecorder(0))
+	defer limiting.Unregister("admin-api")
+
+	code, s := serve(t, http.MethodGet, "/debug/plato/admin/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, s.Disabled)
+	assert.Contains(t, s.Limiters, "admin-api")
+
+	code, s = serve(t, http.MethodPost, "/debug/plato/admin/disable")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, s.Disabled)
+	code, s = serve(t, http.MethodPost, "/debug/plato/admin/enable")
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, s.Disabled)
+
+	code, s = serve(t, http.MethodPost, "/debug/plato/admin/force?name=admin-api&ratio=2500&ttl=1m")
+	assert.Equal(t, http.StatusOK, code)
+	require.Len(t, s.Overrides, 1)
+	assert.Equal(t, Override{Name: "admin-api", Ratio: 2500, Expires: s.Overrides[0].Expires}, s.Overrides[0])
+	code, s = serve(t, http.MethodPost, "/debug/plato/admin/clear?name=admin-api")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, s.Overrides)
+
+	for target, want := range map[string]int{
+		"/debug/plato/admin/force?name=admin-api&ratio=2500&ttl=soon": http.StatusBadRequest,
+		"/debug/plato/admin/force?name=missing&ratio=2500&ttl=1m":     http.StatusBadRequest,
+		"/debug/plato/admin/restart":                                  http.StatusNotFound,
+	} {
+		code, _ = serve(t, http.MethodPost, target)
+		assert.Equal(t, want, code, target)
+	}
+	code, _ = serve(t, http.MethodDelete, "/debug/plato/admin/disable")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package adaptive
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/gin-gonic/gin"
+)
+
+/**
+CoDel (controlled delay) admission control, a request is dropped by how long it has already waited before reaching the handler.
+when the minimal queueing delay of the last interval stays above the target, the instance is overloaded and only requests
+that waited less than the target are admitted, so the freshest requests are served first (LIFO-ish) while the stale ones,
+whose callers probably gave up already, are shed.
+*/
+
+const (
+	defaultCoDelTarget   = 5 * time.Millisecond
+	defaultCoDelInterval = 100 * time.Millisecond
+
+	// DefaultArrivalHeader is set by proxies like nginx, eg. "t=1600000000123456". It is not read unless enabled
+	// by WithArrivalHeader, a client could forge it and a proxy clock could be skewed
+	DefaultArrivalHeader = "X-Request-Start"
+
+	// maxSojourn bounds the sojourn of a request, an arrival header older than it is taken as skewed and ignored
+	maxSojourn = time.Minute
+
+	arrivalContextKey = "plato_arrival_time"
+)
+
+type CoDel struct {
+	target        time.Duration
+	interval      time.Duration
+	mu            sync.Mutex
+	intervalStart time.Time
+	minDelay      time.Duration
+	overloaded    bool
+	now           func() time.Time
+}
+
+func NewCoDel(target, interval time.Duration) *CoDel {
+	return &CoDel{
+		target:   target,
+		interval: interval,
+		minDelay: -1,
+		now:      time.Now,
+	}
+}
+
+// Admit reports whether a request that has waited sojourn should be handled, requests are only dropped while
+// the queue is standing
+func (c *CoDel) Admit(sojourn time.Duration) bool {
+	if sojourn < 0 {
+		sojourn = 0
+	} else if sojourn > maxSojourn {
+		sojourn = maxSojourn
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if c.intervalStart.IsZero() {
+		c.intervalStart = now
+	}
+	if now.Sub(c.intervalStart) >= c.interval {
+		// the delay never went below the target during a whole interval, the queue is standing
+		c.overloaded = c.minDelay > c.target
+		c.intervalStart = now
+		c.minDelay = sojourn
+	} else if c.minDelay < 0 || sojourn < c.minDelay {
+		c.minDelay = sojourn
+	}
+	if c.overloaded {
+		return sojourn <= c.target
+	}
+	return true
+}
+
+// Overloaded reports whether the last interval ended with a standing queue
+func (c *CoDel) Overloaded() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.overloaded
+}
+
+type coDelOptions struct {
+	target        time.Duration
+	interval      time.Duration
+	arrivalHeader string
+}
+
+type CoDelOption func(*coDelOptions)
+
+// WithCoDelTarget sets the acceptable queueing delay
+func WithCoDelTarget(target time.Duration) CoDelOption {
+	return func(options *coDelOptions) {
+		options.target = target
+	}
+}
+
+// WithCoDelInterval sets how long the delay must stay above the target before shedding
+func WithCoDelInterval(interval time.Duration) CoDelOption {
+	return func(options *coDelOptions) {
+		options.interval = interval
+	}
+}
+
+// WithArrivalHeader reads the arrival timestamp from header, eg. DefaultArrivalHeader. Only enable it behind a proxy
+// that overwrites the header, timestamps in the future or older than a minute are ignored
+func WithArrivalHeader(header string) CoDelOption {
+	return func(options *coDelOptions) {
+		options.arrivalHeader = header
+	}
+}
+
+// ArrivalMiddlewareGin records the arrival time of a request, it should be the first middleware of the engine
+// so that the time spent in the other middlewares counts as queueing delay
+func ArrivalMiddlewareGin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(arrivalContextKey, time.Now())
+		c.Next()
+	}
+}
+
+// CoDelMiddlewareGin drops requests by their sojourn time, the arrival time is taken from the arrival header if
+// enabled, or from ArrivalMiddlewareGin, or the request is treated as just arrived
+func CoDelMiddlewareGin(opts ...CoDelOption) gin.HandlerFunc {
+	options := &coDelOptions{
+		target:   defaultCoDelTarget,
+		interval: defaultCoDelInterval,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	codel := NewCoDel(options.target, options.interval)
+	return func(c *gin.Context) {
+		now := codel.now()
+		arrival := arrivalTime(c, options.arrivalHeader, now)
+		// the queue is still tracked while limiting.DisableAll is in effect
+		if !codel.Admit(now.Sub(arrival)) && !limiting.AllDisabled() {
+			_ = c.AbortWithError(defaultRejectStatus, fmt.Errorf("block by codel"))
+			return
+		}
+		c.Next()
+	}
+}
+
+func arrivalTime(c *gin.Context, header string, now time.Time) time.Time {
+	if header != "" {
+		if t, ok := parseArrivalHeader(c.GetHeader(header)); ok && !t.After(now) && now.Sub(t) <= maxSojourn {
+			return t
+		}
+	}
+	if v, ok := c.Get(arrivalContextKey); ok {
+		if t, ok := v.(time.Time); ok {
+			return t
+		}
+	}
+	return now
+}
+
+// parseArrivalHeader accepts unix timestamps in seconds, milliseconds, microseconds or nanoseconds,
+// with an optional "t=" prefix, the unit is guessed by the magnitude
+func parseArrivalHeader(value string) (time.Time, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "t=")
+	if value == "" {
+		return time.Time{}, false
+	}
+	if strings.Contains(value, ".") {
+		// fractional seconds, eg. "1600000000.123"
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f <= 0 {
+			return time.Time{}, false
+		}
+		return time.Unix(0, int64(math.Round(f*1e6))*1e3), true
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}, false
+	}
+	switch {
+	case n < 1e11:
+		return time.Unix(n, 0), true
+	case n < 1e14:
+		return time.UnixMilli(n), true
+	case n < 1e17:
+		return time.UnixMicro(n), true
+	}
+	return time.Unix(0, n), true
+}
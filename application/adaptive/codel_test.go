@@ -0,0 +1,143 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package adaptive
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoDel(t *testing.T) {
+	now := time.UnixMilli(1000000)
+	codel := NewCoDel(5*time.Millisecond, 100*time.Millisecond)
+	codel.now = func() time.Time { return now }
+
+	assert.True(t, codel.Admit(20*time.Millisecond))
+	now = now.Add(50 * time.Millisecond)
+	assert.True(t, codel.Admit(30*time.Millisecond))
+	// nothing is dropped before the queue is found standing, however long the request waited
+	assert.True(t, codel.Admit(200*time.Millisecond))
+	assert.True(t, codel.Admit(time.Hour))
+
+	// the delay stayed above the target for a whole interval
+	now = now.Add(60 * time.Millisecond)
+	assert.False(t, codel.Admit(20*time.Millisecond))
+	assert.True(t, codel.Overloaded())
+	assert.True(t, codel.Admit(time.Millisecond))
+
+	// the queue drained during the interval
+	now = now.Add(100 * time.Millisecond)
+	assert.True(t, codel.Admit(20*time.Millisecond))
+	assert.False(t, codel.Overloaded())
+}
+
+func TestParseArrivalHeader(t *testing.T) {
+	want := time.Unix(1600000000, 123000000)
+	for _, v := range []string{"1600000000.123", "1600000000123", "t=1600000000123000", "1600000000123000000"} {
+		got, ok := parseArrivalHeader(v)
+		assert.True(t, ok, v)
+		assert.Equal(t, want.UnixMilli(), got.UnixMilli(), v)
+	}
+	_, ok := parseArrivalHeader("abc")
+	assert.False(t, ok)
+}
+
+func TestCoDelMiddlewareGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CoDelMiddlewareGin(WithCoDelInterval(10 * time.Millisecond)))
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	// the arrival header is not read by default, a stale or forged one is harmless
+	stale := strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10)
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(DefaultArrivalHeader, stale)
+		assert.Equal(t, http.StatusOK, serve(r, req).Code)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	r = gin.New()
+	r.Use(CoDelMiddlewareGin(WithArrivalHeader(DefaultArrivalHeader)))
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	request := func(waited time.Duration) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(DefaultArrivalHeader, strconv.FormatInt(time.Now().Add(-waited).UnixMilli(), 10))
+		return serve(r, req).Code
+	}
+	// a long wait alone does not drop, the queue is not standing yet
+	assert.Equal(t, http.StatusOK, request(time.Second))
+	// a header far in the past is taken as skewed and ignored
+	assert.Equal(t, http.StatusOK, request(2*time.Hour))
+}
+
+func TestCoDelMiddlewareGinDisableAll(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CoDelMiddlewareGin(WithCoDelInterval(5*time.Millisecond), WithArrivalHeader(DefaultArrivalHeader)))
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	request := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(DefaultArrivalHeader, strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10))
+		return serve(r, req).Code
+	}
+	dropped := false
+	for i := 0; i < 20 && !dropped; i++ {
+		dropped = request() != http.StatusOK
+		time.Sleep(2 * time.Millisecond)
+	}
+	require.True(t, dropped, "a standing queue is never dropped")
+
+	limiting.DisableAll()
+	defer limiting.EnableAll()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, http.StatusOK, request())
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestArrivalTime(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Now()
+	for _, c := range []struct {
+		header string
+		want   time.Time
+	}{
+		{strconv.FormatInt(now.Add(-time.Second).UnixMilli(), 10), time.UnixMilli(now.Add(-time.Second).UnixMilli())},
+		{strconv.FormatInt(now.Add(time.Hour).UnixMilli(), 10), now},
+		{strconv.FormatInt(now.Add(-2*time.Hour).UnixMilli(), 10), now},
+	} {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		ctx.Request.Header.Set(DefaultArrivalHeader, c.header)
+		assert.Equal(t, c.want, arrivalTime(ctx, DefaultArrivalHeader, now), c.header)
+		assert.Equal(t, now, arrivalTime(ctx, "", now), c.header)
+	}
+}
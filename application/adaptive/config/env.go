@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/bytedance/pid_limits/core/system"
+	"github.com/bytedance/pid_limits/metrics/system/cpu"
+	"github.com/bytedance/pid_limits/util/logging"
+)
+
+// The PLATO_* environment variables override the limiter options per deployment. The precedence, from the lowest,
+// is the defaults, the environment, the options given in code and the config file of the reload package.
+// EnvCPUSource and EnvLogLevel are process wide and read once when the program starts.
+const (
+	EnvThreshold  = "PLATO_THRESHOLD"
+	EnvDrift      = "PLATO_DRIFT"
+	EnvDisable    = "PLATO_DISABLE"
+	EnvDryRun     = "PLATO_DRY_RUN"
+	EnvMonitorAlg = "PLATO_MONITOR_ALG"
+	EnvCPUSource  = system.EnvCPUSource
+	EnvLogLevel   = logging.EnvLevel
+)
+
+// WithEnv applies the PLATO_* environment variables that are set, an unparsable value is reported and ignored.
+// NewOptions applies it to the defaults, the options given in code and the config file take precedence over it
+func WithEnv() OptionFunc {
+	return func(options *Options) {
+		envFloat(EnvThreshold, &options.Threshold)
+		envFloat(EnvDrift, &options.Drift)
+		envBool(EnvDisable, &options.Disabled)
+		envBool(EnvDryRun, &options.DryRun)
+		if name, ok := os.LookupEnv(EnvMonitorAlg); ok {
+			alg, err := cpu.ParseMonitorAlg(name)
+			if err != nil {
+				warnEnv(EnvMonitorAlg, err)
+				return
+			}
+			options.MonitorAlg = alg
+		}
+	}
+}
+
+func envFloat(name string, f *float64) {
+	if value, ok := os.LookupEnv(name); ok {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			warnEnv(name, err)
+			return
+		}
+		*f = v
+	}
+}
+
+func envBool(name string, b *bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			warnEnv(name, err)
+			return
+		}
+		*b = v
+	}
+}
+
+func warnEnv(name string, err error) {
+	logging.Warn("ignore invalid environment variable", "name", name, "err", err)
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/bytedance/pid_limits/metrics/system/cpu"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewOptionsEnv(t *testing.T) {
+	t.Setenv(EnvThreshold, "0.7")
+	t.Setenv(EnvDrift, "0.05")
+	t.Setenv(EnvDisable, "true")
+	t.Setenv(EnvDryRun, "1")
+	t.Setenv(EnvMonitorAlg, "raw")
+	opt := NewOptions()
+	assert.Equal(t, 0.7, opt.Threshold)
+	assert.Equal(t, 0.05, opt.Drift)
+	assert.True(t, opt.Disabled)
+	assert.True(t, opt.DryRun)
+	assert.Equal(t, cpu.Raw, opt.MonitorAlg)
+
+	// the options given in code take precedence over the environment
+	WithThreshold(0.9)(opt)
+	assert.Equal(t, 0.9, opt.Threshold)
+}
+
+func TestNewOptionsInvalidEnv(t *testing.T) {
+	t.Setenv(EnvThreshold, "high")
+	t.Setenv(EnvDryRun, "maybe")
+	t.Setenv(EnvMonitorAlg, "kalman")
+	opt := NewOptions()
+	assert.Equal(t, 0.8, opt.Threshold)
+	assert.False(t, opt.DryRun)
+	assert.Equal(t, cpu.ZScore, opt.MonitorAlg)
+}
@@ -16,26 +16,137 @@
 package config
 
 import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bytedance/pid_limits/core/event"
 	"github.com/bytedance/pid_limits/metrics/system/cpu"
+	"github.com/bytedance/pid_limits/util/logging"
 )
 
 type Options struct {
+	// Name registers the limiter under this name, limiters without a name are registered as kind-N
+	Name string
+	// Kp, Ki and Kd are the pid gains, Threshold is the cpu usage set point, NewPidLimiting sets them from its arguments
+	Kp, Ki, Kd          float64
+	Threshold           float64
 	EnableMetric        bool
 	EnableOverloadScene bool
 	MonitorAlg          cpu.MonitorAlg
-	DynamicPoint        func() float64
-	Drift               float64
+	// Score is the z-score critical value of the ZScore and MAD monitors, 0 keeps the monitor default
+	Score float64
+	// Alpha is the weight of the latest sample of the EWMA monitor, Percentile the percentile, 0 ~ 1, of the window the
+	// Percentile monitor decides on, 0 keeps the monitor defaults, 0.3 and the median
+	Alpha      float64
+	Percentile float64
+	// ForecastModel and Horizon are the trend and how far ahead the Forecast monitor projects the cpu usage, Beta the
+	// weight of the latest change in the Holt trend, 0 keeps the monitor defaults, 3s and 0.3
+	ForecastModel cpu.ForecastModel
+	Horizon       time.Duration
+	Beta          float64
+	// EnterTimes and ExitTimes are the consecutive decisions of the ZScore monitor confirming the start and the end of
+	// an overload, EmergencyThreshold starts it at once, 0 keeps the monitor defaults, 30, 30 and 0.99
+	EnterTimes         uint32
+	ExitTimes          uint32
+	EmergencyThreshold float64
+	// EnterWait and ExitWait are how long the Raw monitor confirms the start and the end of an overload,
+	// 0 keeps the monitor default of 6s
+	EnterWait time.Duration
+	ExitWait  time.Duration
+	// MonitorInterval is how often the monitor decides, 0 keeps the monitor default of 100ms
+	MonitorInterval time.Duration
+	// MonitorWindow and MonitorWindowSize give the ZScore monitor its own window of samples,
+	// 0 keeps the window of the cpu collector, 100 samples within 6s, the ZScore monitor keeps the last 100 decisions
+	MonitorWindow     time.Duration
+	MonitorWindowSize int
+
+	DynamicPoint func() float64
+	Drift        float64
+	// DryRun admits every request, the would-be rejections are only counted
+	DryRun bool
+	// Disabled admits every request without counting the would-be rejections
+	Disabled bool
+	// BBRWindow and BBRBuckets define the pass count and rt windows of the bbr limiter
+	BBRWindow  time.Duration
+	BBRBuckets int
+	// MaxTenants bounds the tenants tracked by the tenant limiter, TenantWindow is the window their rates are counted in
+	MaxTenants   int
+	TenantWindow time.Duration
+	// Logger is the logger of the limiter, the global logging.Default() is used if nil
+	Logger logging.Logger
+	// EventHandlers receive the events of the limiter, in addition to the subscribers of the global event bus
+	EventHandlers []event.Handler
+	// RatioEventStep is the reject ratio move, in 0 ~ 10000, that publishes a RatioChanged event, 0 disables it
+	RatioEventStep float64
+	// RecorderSize is the number of control loop ticks kept by the flight recorder, 0 disables it
+	RecorderSize int
+	// RecorderDumpDir and RecorderDumpFormat ("csv" or "jsonl") dump the recorder to a file when an overload ends
+	RecorderDumpDir    string
+	RecorderDumpFormat string
+	// RecoveryWindow is how long the reject ratio takes to decay to 0 after an overload ends, 0 stops rejecting at once.
+	// RecoveryCurve is the shape of the decay, RecoveryLinear or RecoveryExponential
+	RecoveryWindow time.Duration
+	RecoveryCurve  string
 }
 
+const (
+	RecoveryLinear      = "linear"
+	RecoveryExponential = "exponential"
+)
+
 type OptionFunc func(*Options)
 
+// NewOptions returns the default options overridden by the PLATO_* environment variables, see WithEnv
 func NewOptions() *Options {
-	return &Options{
+	options := &Options{
+		Threshold:           0.8,
 		EnableMetric:        true,
 		EnableOverloadScene: false,
 		MonitorAlg:          cpu.ZScore,
 		DynamicPoint:        nil,
 		Drift:               0.1,
+		BBRWindow:           10 * time.Second,
+		BBRBuckets:          100,
+		MaxTenants:          1024,
+		TenantWindow:        10 * time.Second,
+		RatioEventStep:      1000,
+		RecorderSize:        3000,
+		RecoveryCurve:       RecoveryLinear,
+	}
+	WithEnv()(options)
+	return options
+}
+
+func WithName(name string) OptionFunc {
+	return func(options *Options) {
+		options.Name = name
+	}
+}
+
+// WithGains sets the pid gains, for PIDLimiting.Update
+func WithGains(kp, ki, kd float64) OptionFunc {
+	return func(options *Options) {
+		options.Kp, options.Ki, options.Kd = kp, ki, kd
+	}
+}
+
+// WithThreshold sets the cpu usage set point, 0 ~ 1, for PIDLimiting.Update
+func WithThreshold(threshold float64) OptionFunc {
+	return func(options *Options) {
+		options.Threshold = threshold
+	}
+}
+
+func WithScore(score float64) OptionFunc {
+	return func(options *Options) {
+		options.Score = score
+	}
+}
+
+func WithEnableMetric() OptionFunc {
+	return func(options *Options) {
+		options.EnableMetric = true
 	}
 }
 
@@ -68,3 +179,225 @@ func WithDrift(f float64) OptionFunc {
 		options.Drift = f
 	}
 }
+
+// WithDryRun runs the limiter in shadow mode, Limit() always admits and the would-be rejections are counted
+func WithDryRun() OptionFunc {
+	return func(options *Options) {
+		options.DryRun = true
+	}
+}
+
+// WithDisabled admits every request, the limiter keeps running but never rejects
+func WithDisabled() OptionFunc {
+	return func(options *Options) {
+		options.Disabled = true
+	}
+}
+
+// WithBBRWindow sets the window the bbr limiter measures the pass count and rt in, split into buckets, at least 2
+func WithBBRWindow(window time.Duration, buckets int) OptionFunc {
+	return func(options *Options) {
+		options.BBRWindow = window
+		options.BBRBuckets = buckets
+	}
+}
+
+func WithMaxTenants(n int) OptionFunc {
+	return func(options *Options) {
+		options.MaxTenants = n
+	}
+}
+
+func WithTenantWindow(window time.Duration) OptionFunc {
+	return func(options *Options) {
+		options.TenantWindow = window
+	}
+}
+
+func WithLogger(logger logging.Logger) OptionFunc {
+	return func(options *Options) {
+		options.Logger = logger
+	}
+}
+
+// WithEventHandler subscribes h to the events of this limiter only
+func WithEventHandler(h event.Handler) OptionFunc {
+	return func(options *Options) {
+		options.EventHandlers = append(options.EventHandlers, h)
+	}
+}
+
+func WithRatioEventStep(step float64) OptionFunc {
+	return func(options *Options) {
+		options.RatioEventStep = step
+	}
+}
+
+// WithRecorder sets the number of control loop ticks kept by the flight recorder, 0 disables it
+func WithRecorder(size int) OptionFunc {
+	return func(options *Options) {
+		options.RecorderSize = size
+	}
+}
+
+// WithRecorderDump dumps the flight recorder to a new file in dir each time an overload ends,
+// format is "csv" or "jsonl"
+func WithRecorderDump(dir string, format string) OptionFunc {
+	return func(options *Options) {
+		options.RecorderDumpDir = dir
+		options.RecorderDumpFormat = format
+	}
+}
+
+// WithAlpha sets the weight of the latest sample of the EWMA monitor, in (0, 1]
+func WithAlpha(alpha float64) OptionFunc {
+	return func(options *Options) {
+		options.Alpha = alpha
+	}
+}
+
+// WithPercentile sets the percentile, in (0, 1], of the window the Percentile monitor decides on
+func WithPercentile(percentile float64) OptionFunc {
+	return func(options *Options) {
+		options.Percentile = percentile
+	}
+}
+
+// WithForecast sets the trend fitted by the Forecast monitor and how far ahead it projects the cpu usage
+func WithForecast(model cpu.ForecastModel, horizon time.Duration) OptionFunc {
+	return func(options *Options) {
+		options.ForecastModel = model
+		options.Horizon = horizon
+	}
+}
+
+// WithBeta sets the weight of the latest change in the trend of the Holt forecast, in (0, 1]
+func WithBeta(beta float64) OptionFunc {
+	return func(options *Options) {
+		options.Beta = beta
+	}
+}
+
+// WithContinuousTimes sets the consecutive decisions of the ZScore monitor confirming the start and the end of an
+// overload
+func WithContinuousTimes(enter, exit uint32) OptionFunc {
+	return func(options *Options) {
+		options.EnterTimes = enter
+		options.ExitTimes = exit
+	}
+}
+
+// WithEmergencyThreshold sets the cpu usage starting an overload without confirmation, a value above 1 disables it
+func WithEmergencyThreshold(emergency float64) OptionFunc {
+	return func(options *Options) {
+		options.EmergencyThreshold = emergency
+	}
+}
+
+// WithConfirmWait sets how long the Raw monitor confirms the start and the end of an overload
+func WithConfirmWait(enter, exit time.Duration) OptionFunc {
+	return func(options *Options) {
+		options.EnterWait = enter
+		options.ExitWait = exit
+	}
+}
+
+// WithMonitorInterval sets how often the monitor decides
+func WithMonitorInterval(interval time.Duration) OptionFunc {
+	return func(options *Options) {
+		options.MonitorInterval = interval
+	}
+}
+
+// WithMonitorWindow gives the monitor its own window of the size last samples within length, the ZScore monitor
+// keeps the last size decisions, capped to the decisions within length
+func WithMonitorWindow(length time.Duration, size int) OptionFunc {
+	return func(options *Options) {
+		options.MonitorWindow = length
+		options.MonitorWindowSize = size
+	}
+}
+
+// WithRecovery keeps rejecting after an overload ends, the last reject ratio decays to 0 over window along curve,
+// RecoveryLinear or RecoveryExponential. The decay is held while the cpu usage is above the set point
+func WithRecovery(window time.Duration, curve string) OptionFunc {
+	return func(options *Options) {
+		options.RecoveryWindow = window
+		options.RecoveryCurve = curve
+	}
+}
+
+// Validate reports the first invalid option
+func (o *Options) Validate() error {
+	for i, gain := range []float64{o.Kp, o.Ki, o.Kd} {
+		if gain < 0 || math.IsNaN(gain) || math.IsInf(gain, 0) {
+			return fmt.Errorf("config: %s should be a finite number >= 0, got %v", [...]string{"Kp", "Ki", "Kd"}[i], gain)
+		}
+	}
+	if !(o.Threshold > 0 && o.Threshold <= 1) {
+		return fmt.Errorf("config: Threshold should be in (0, 1], got %v", o.Threshold)
+	}
+	if !(o.Drift >= 0 && o.Drift < 1) {
+		return fmt.Errorf("config: Drift should be in [0, 1), got %v", o.Drift)
+	}
+	if o.DynamicPoint != nil {
+		if point := o.DynamicPoint(); !(point > 0 && point <= 1) {
+			return fmt.Errorf("config: DynamicPoint should return a value in (0, 1], got %v", point)
+		}
+	}
+	if !o.MonitorAlg.Valid() {
+		return fmt.Errorf("config: unknown MonitorAlg %d", o.MonitorAlg)
+	}
+	if !(o.Score >= 0) {
+		return fmt.Errorf("config: Score should be >= 0, got %v", o.Score)
+	}
+	if !(o.Alpha >= 0 && o.Alpha <= 1) {
+		return fmt.Errorf("config: Alpha should be in [0, 1], got %v", o.Alpha)
+	}
+	if !(o.Percentile >= 0 && o.Percentile <= 1) {
+		return fmt.Errorf("config: Percentile should be in [0, 1], got %v", o.Percentile)
+	}
+	if o.ForecastModel != cpu.ForecastLinear && o.ForecastModel != cpu.ForecastHolt {
+		return fmt.Errorf("config: unknown ForecastModel %d", o.ForecastModel)
+	}
+	if o.Horizon < 0 {
+		return fmt.Errorf("config: Horizon should be >= 0, got %v", o.Horizon)
+	}
+	if !(o.Beta >= 0 && o.Beta <= 1) {
+		return fmt.Errorf("config: Beta should be in [0, 1], got %v", o.Beta)
+	}
+	if !(o.EmergencyThreshold >= 0) {
+		return fmt.Errorf("config: EmergencyThreshold should be >= 0, got %v", o.EmergencyThreshold)
+	}
+	if o.EnterWait < 0 || o.ExitWait < 0 || o.MonitorInterval < 0 {
+		return fmt.Errorf("config: EnterWait, ExitWait and MonitorInterval should be >= 0, got %v, %v and %v",
+			o.EnterWait, o.ExitWait, o.MonitorInterval)
+	}
+	if o.MonitorWindow < 0 || o.MonitorWindowSize < 0 || (o.MonitorWindow == 0) != (o.MonitorWindowSize == 0) {
+		return fmt.Errorf("config: MonitorWindow and MonitorWindowSize should both be > 0 or both 0, got %v and %d",
+			o.MonitorWindow, o.MonitorWindowSize)
+	}
+	if o.BBRWindow <= 0 || o.BBRBuckets < 2 {
+		// a rolling window of a single bucket reduces no bucket, the bbr limiter would never measure anything
+		return fmt.Errorf("config: BBRWindow should be > 0 and BBRBuckets >= 2, got %v and %d", o.BBRWindow, o.BBRBuckets)
+	}
+	if o.MaxTenants <= 0 || o.TenantWindow <= 0 {
+		return fmt.Errorf("config: MaxTenants and TenantWindow should be > 0, got %d and %v", o.MaxTenants, o.TenantWindow)
+	}
+	if !(o.RatioEventStep >= 0) {
+		return fmt.Errorf("config: RatioEventStep should be >= 0, got %v", o.RatioEventStep)
+	}
+	if o.RecorderSize < 0 {
+		return fmt.Errorf("config: RecorderSize should be >= 0, got %d", o.RecorderSize)
+	}
+	if o.RecorderDumpDir != "" && o.RecorderDumpFormat != "csv" && o.RecorderDumpFormat != "jsonl" {
+		return fmt.Errorf("config: RecorderDumpFormat should be csv or jsonl, got %q", o.RecorderDumpFormat)
+	}
+	if o.RecoveryWindow < 0 {
+		return fmt.Errorf("config: RecoveryWindow should be >= 0, got %v", o.RecoveryWindow)
+	}
+	if o.RecoveryCurve != RecoveryLinear && o.RecoveryCurve != RecoveryExponential {
+		return fmt.Errorf("config: RecoveryCurve should be linear or exponential, got %q", o.RecoveryCurve)
+	}
+	return nil
+}
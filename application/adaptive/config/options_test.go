@@ -17,7 +17,10 @@ package  config
 
 import (
 	"github.com/go-playground/assert/v2"
+	"github.com/bytedance/pid_limits/metrics/system/cpu"
+	"math"
 	"testing"
+	"time"
 )
 
 func TestNewOption(t *testing.T) {
@@ -27,3 +30,35 @@ func TestNewOption(t *testing.T) {
 	WithDisableMetric()(opt)
 	assert.Equal(t, false, opt.EnableMetric)
 }
+
+func TestValidate(t *testing.T) {
+	opt := NewOptions()
+	assert.Equal(t, nil, opt.Validate())
+
+	for _, f := range []OptionFunc{
+		WithGains(-1, 0, 0),
+		WithThreshold(0),
+		WithThreshold(1.2),
+		WithDrift(1),
+		WithMonitorAlg(42),
+		WithRecorder(-1),
+		WithRecorderDump("/tmp", "xml"),
+		WithGains(math.NaN(), 0, 0),
+		WithDynamicPoint(func() float64 { return math.NaN() }),
+		WithDynamicPoint(func() float64 { return 1.5 }),
+		WithRecovery(-time.Second, RecoveryLinear),
+		WithRecovery(time.Second, "cubic"),
+		WithMonitorWindow(time.Second, 0),
+		WithMonitorInterval(-time.Second),
+		WithEmergencyThreshold(-1),
+		WithAlpha(1.5),
+		WithPercentile(-0.1),
+		WithForecast(cpu.ForecastModel(9), time.Second),
+		WithForecast(cpu.ForecastLinear, -time.Second),
+		WithBeta(1.5),
+	} {
+		opt := NewOptions()
+		f(opt)
+		assert.NotEqual(t, nil, opt.Validate())
+	}
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+// Package debug dumps the live state of the limiters, the cpu collector and the background calculated metrics as json,
+// through an http.Handler and expvar
+package debug
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	plato "github.com/bytedance/pid_limits"
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/bytedance/pid_limits/core/system"
+	"github.com/bytedance/pid_limits/metrics/system/cpu"
+)
+
+const (
+	// ExpvarName is the expvar the state is published under by Publish
+	ExpvarName = "plato"
+
+	defaultSamples = 20
+)
+
+// State is the dump of the limiters, json cannot encode NaN and ±Inf so non-finite numbers, eg. the rt of an entry
+// without requests, are reported as 0
+type State struct {
+	CPU        CPUState        `json:"cpu"`
+	Limiters   []LimiterState  `json:"limiters"`
+	Calculator CalculatorState `json:"calculator"`
+}
+
+type CPUState struct {
+	Source  string    `json:"source"`
+	Enabled bool      `json:"enabled"`
+	Usage   float64   `json:"usage"`
+	Samples []float64 `json:"samples"`
+}
+
+type LimiterState struct {
+	Name       string       `json:"name"`
+	Type       string       `json:"type"`
+	Ratio      float64      `json:"ratio"`
+	Overloaded *bool        `json:"overloaded,omitempty"`
+	Stats      *StatsState  `json:"stats,omitempty"`
+	PID        *PIDState    `json:"pid,omitempty"`
+	Monitor    *MonitorView `json:"monitor,omitempty"`
+}
+
+type StatsState struct {
+	DryRun         bool    `json:"dry_run"`
+	Disabled       bool    `json:"disabled"`
+	ShadowRatio    float64 `json:"shadow_ratio"`
+	Requests       uint64  `json:"requests"`
+	Rejected       uint64  `json:"rejected"`
+	ShadowRejected uint64  `json:"shadow_rejected"`
+}
+
+type PIDState struct {
+	SetPoint float64 `json:"set_point"`
+	Kp       float64 `json:"kp"`
+	Ki       float64 `json:"ki"`
+	Kd       float64 `json:"kd"`
+	ErrSum   float64 `json:"err_sum"`
+	Output   float64 `json:"output"`
+}
+
+type MonitorView struct {
+	Alg             string          `json:"alg"`
+	UpperThreshold  float64         `json:"upper_threshold"`
+	LowerThreshold  float64         `json:"lower_threshold"`
+	ContinuousTimes uint32          `json:"continuous_times"`
+	Prediction      *PredictionView `json:"prediction,omitempty"`
+}
+
+type PredictionView struct {
+	Model    string  `json:"model"`
+	Level    float64 `json:"level"`
+	Slope    float64 `json:"slope_per_second"`
+	Forecast float64 `json:"forecast"`
+	Horizon  string  `json:"horizon"`
+	// TimeToBreachMs is -1 when the trend does not cross the upper bound
+	TimeToBreachMs int64 `json:"time_to_breach_ms"`
+}
+
+type CalculatorState struct {
+	Metrics int          `json:"metrics"`
+	Entries []EntryState `json:"entries"`
+}
+
+type EntryState struct {
+	Name    string             `json:"name"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+type Option func(*options)
+
+type options struct {
+	samples int
+}
+
+// WithSamples sets the number of the latest cpu samples in the dump, 20 by default
+func WithSamples(n int) Option {
+	return func(o *options) {
+		o.samples = n
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{samples: defaultSamples}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Handler serves the current State as json
+func Handler(opts ...Option) http.Handler {
+	o := newOptions(opts)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(snapshot(o))
+	})
+}
+
+var (
+	publishOnce    sync.Once
+	publishOptions atomic.Value // *options
+)
+
+// Publish publishes the State as the expvar "plato", it can be called more than once, the options of the last call are used
+func Publish(opts ...Option) {
+	publishOptions.Store(newOptions(opts))
+	publishOnce.Do(func() {
+		expvar.Publish(ExpvarName, expvar.Func(func() interface{} {
+			return snapshot(publishOptions.Load().(*options))
+		}))
+	})
+}
+
+// Snapshot returns the current State
+func Snapshot(opts ...Option) State {
+	return snapshot(newOptions(opts))
+}
+
+func snapshot(o *options) State {
+	samples := system.ExtractCPUWindows()
+	if o.samples >= 0 && len(samples) > o.samples {
+		samples = samples[len(samples)-o.samples:]
+	}
+	state := State{
+		CPU: CPUState{
+			Source:  system.CPUSource(),
+			Enabled: system.CPUUsageEnabled(),
+			Usage:   finite(cpu.GetUsage()),
+			Samples: finiteAll(samples),
+		},
+		Limiters: []LimiterState{},
+		Calculator: CalculatorState{
+			Metrics: plato.DefaultCalculateManager().MetricCount(),
+			Entries: []EntryState{},
+		},
+	}
+	for _, nl := range limiting.Limiters() {
+		state.Limiters = append(state.Limiters, limiterState(nl))
+	}
+	for _, e := range plato.Entries() {
+		state.Calculator.Entries = append(state.Calculator.Entries, entryState(e))
+	}
+	return state
+}
+
+func limiterState(nl limiting.NamedLimit) LimiterState {
+	s := LimiterState{
+		Name:  nl.Name,
+		Type:  fmt.Sprintf("%T", nl.Limit),
+		Ratio: finite(nl.Limit.LimitRatio()),
+	}
+	if l, ok := nl.Limit.(limiting.OverloadLimit); ok {
+		overloaded := l.Overloaded()
+		s.Overloaded = &overloaded
+	}
+	if l, ok := nl.Limit.(limiting.StatsLimit); ok {
+		s.Stats = statsState(l.Stats())
+	}
+	if l, ok := nl.Limit.(*limiting.PIDLimiting); ok {
+		snapshot := l.Snapshot()
+		s.Stats = statsState(snapshot.Stats)
+		s.PID = &PIDState{
+			SetPoint: finite(snapshot.SetPoint),
+			Kp:       finite(snapshot.Kp),
+			Ki:       finite(snapshot.Ki),
+			Kd:       finite(snapshot.Kd),
+			ErrSum:   finite(snapshot.ErrSum),
+			Output:   finite(snapshot.Output),
+		}
+		if snapshot.Monitor != nil {
+			s.Monitor = monitorView(*snapshot.Monitor)
+		}
+	}
+	return s
+}
+
+func statsState(stats limiting.Stats) *StatsState {
+	return &StatsState{
+		DryRun:         stats.DryRun,
+		Disabled:       stats.Disabled,
+		ShadowRatio:    finite(stats.ShadowRatio),
+		Requests:       stats.Requests,
+		Rejected:       stats.Rejected,
+		ShadowRejected: stats.ShadowRejected,
+	}
+}
+
+func monitorView(m cpu.MonitorState) *MonitorView {
+	v := &MonitorView{
+		Alg:             m.Alg.String(),
+		UpperThreshold:  finite(m.UpperThreshold),
+		LowerThreshold:  finite(m.LowerThreshold),
+		ContinuousTimes: m.ContinuousTimes,
+	}
+	if p := m.Prediction; p != nil {
+		v.Prediction = &PredictionView{
+			Model:          p.Model.String(),
+			Level:          finite(p.Level),
+			Slope:          finite(p.Slope),
+			Forecast:       finite(p.Forecast),
+			Horizon:        p.Horizon.String(),
+			TimeToBreachMs: -1,
+		}
+		if p.TimeToBreach >= 0 {
+			v.Prediction.TimeToBreachMs = p.TimeToBreach.Milliseconds()
+		}
+	}
+	return v
+}
+
+var metricNames = map[plato.MetricFactory]string{
+	plato.Qps:     "qps",
+	plato.AvgRT:   "avg_rt",
+	plato.PctRT:   "pct_rt",
+	plato.ErrRate: "err_rate",
+}
+
+func entryState(e *plato.PlatoEntry) EntryState {
+	s := EntryState{Name: e.Name, Metrics: map[string]float64{}}
+	for factory := range e.Metrics {
+		name, ok := metricNames[factory]
+		if !ok {
+			name = fmt.Sprintf("custom_%p", factory)
+		}
+		s.Metrics[name] = finite(plato.Chain(e, factory))
+	}
+	return s
+}
+
+func finite(v float64) float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
+
+func finiteAll(vs []float64) []float64 {
+	for i, v := range vs {
+		vs[i] = finite(v)
+	}
+	return vs
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package debug
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	plato "github.com/bytedance/pid_limits"
+	"github.com/bytedance/pid_limits/application/adaptive/config"
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/bytedance/pid_limits/metrics/system/cpu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	limiting.NewPidLimiting(1, 2, 3, 0.8, config.WithName("debug-test"), config.WithDisableMetric())
+	defer limiting.Unregister("debug-test")
+	plato.Init([]*plato.PlatoEntry{plato.DefaultEntry("debug-entry")})
+
+	w := httptest.NewRecorder()
+	Handler(WithSamples(5)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/plato", nil))
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var state State
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &state))
+	assert.NotEmpty(t, state.CPU.Source)
+	assert.LessOrEqual(t, len(state.CPU.Samples), 5)
+	assert.GreaterOrEqual(t, state.Calculator.Metrics, 4)
+
+	var limiter *LimiterState
+	for i := range state.Limiters {
+		if state.Limiters[i].Name == "debug-test" {
+			limiter = &state.Limiters[i]
+		}
+	}
+	require.NotNil(t, limiter)
+	assert.Equal(t, "*limiting.PIDLimiting", limiter.Type)
+	require.NotNil(t, limiter.PID)
+	assert.Equal(t, PIDState{SetPoint: 0.8, Kp: 1, Ki: 2, Kd: 3, ErrSum: limiter.PID.ErrSum, Output: limiter.PID.Output}, *limiter.PID)
+	require.NotNil(t, limiter.Monitor)
+	assert.Equal(t, "zscore", limiter.Monitor.Alg)
+	assert.InDelta(t, 0.9, limiter.Monitor.UpperThreshold, 1e-9)
+	assert.InDelta(t, 0.7, limiter.Monitor.LowerThreshold, 1e-9)
+	require.NotNil(t, limiter.Stats)
+
+	var entry *EntryState
+	for i := range state.Calculator.Entries {
+		if state.Calculator.Entries[i].Name == "debug-entry" {
+			entry = &state.Calculator.Entries[i]
+		}
+	}
+	require.NotNil(t, entry)
+	for _, name := range []string{"qps", "avg_rt", "pct_rt", "err_rate"} {
+		assert.Contains(t, entry.Metrics, name)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	Publish()
+	Publish(WithSamples(3))
+	assert.Equal(t, 3, publishOptions.Load().(*options).samples)
+	v := expvar.Get(ExpvarName)
+	require.NotNil(t, v)
+	var state State
+	require.NoError(t, json.Unmarshal([]byte(v.String()), &state))
+	assert.NotEmpty(t, state.CPU.Source)
+}
+
+type nanLimit struct{}
+
+func (l *nanLimit) Limit() bool {
+	return false
+}
+
+func (l *nanLimit) LimitRatio() float64 {
+	return math.NaN()
+}
+
+func TestHandlerNonFinite(t *testing.T) {
+	limiting.Register("debug-nan", &nanLimit{})
+	defer limiting.Unregister("debug-nan")
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/plato", nil))
+	var state State
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &state))
+	for _, l := range state.Limiters {
+		if l.Name == "debug-nan" {
+			assert.Equal(t, float64(0), l.Ratio)
+			return
+		}
+	}
+	t.Fatal("the limiter is missing from the dump")
+}
+
+func TestMonitorViewPrediction(t *testing.T) {
+	assert.Nil(t, monitorView(cpu.MonitorState{Alg: cpu.Raw}).Prediction)
+
+	v := monitorView(cpu.MonitorState{Alg: cpu.Forecast, Prediction: &cpu.Prediction{
+		Model: cpu.ForecastHolt, Level: 0.6, Slope: 0.1, Forecast: 0.9, Horizon: 3 * time.Second, TimeToBreach: 2 * time.Second,
+	}})
+	assert.Equal(t, "forecast", v.Alg)
+	assert.Equal(t, &PredictionView{Model: "holt", Level: 0.6, Slope: 0.1, Forecast: 0.9, Horizon: "3s", TimeToBreachMs: 2000}, v.Prediction)
+
+	v = monitorView(cpu.MonitorState{Alg: cpu.Forecast, Prediction: &cpu.Prediction{TimeToBreach: -1}})
+	assert.Equal(t, int64(-1), v.Prediction.TimeToBreachMs)
+
+	v = monitorView(cpu.MonitorState{Alg: cpu.Forecast, Prediction: &cpu.Prediction{Slope: math.Inf(1), Level: math.NaN()}})
+	assert.Equal(t, float64(0), v.Prediction.Slope)
+	assert.Equal(t, float64(0), v.Prediction.Level)
+}
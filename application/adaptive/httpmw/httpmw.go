@@ -0,0 +1,110 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+// Package httpmw adapts the adaptive limiters to plain net/http, it has no framework dependency
+// and works with the standard ServeMux and the routers built on it, eg. chi or gorilla/mux
+package httpmw
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/config"
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/bytedance/pid_limits/application/adaptive/route"
+)
+
+// New returns a net/http middleware backed by limit
+func New(limit limiting.RateLimit, opts ...Option) func(http.Handler) http.Handler {
+	o := newOptions(opts)
+	tenantAware := o.tenant != nil
+	routes := make([]routeAdmission, 0, len(o.routes))
+	for _, r := range o.routes {
+		routes = append(routes, routeAdmission{matcher: r.matcher, admission: limiting.NewAdmission(r.limit, tenantAware)})
+	}
+	defaultAdmission := limiting.NewAdmission(limit, tenantAware)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !o.filter.Limited(r.URL.Path, "") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			admission := defaultAdmission
+			for _, ra := range routes {
+				if ra.matcher.Match(r.URL.Path, "") {
+					admission = ra.admission
+					break
+				}
+			}
+			p, hasPriority := o.priority(r)
+			var tenant string
+			if tenantAware {
+				tenant = o.tenant(r)
+			}
+			reject, wouldReject := admission.Limit(p, hasPriority, tenant)
+			if reject {
+				o.reject(w, r, admission.RejectInfo(o.maxRetryAfter))
+				return
+			}
+			if wouldReject {
+				r = o.shadowReject(w, r)
+			}
+			if !admission.Tracked() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			start := time.Now()
+			// deferred, so a panicking handler does not leave the request in flight for good
+			defer func() {
+				admission.Complete(time.Since(start))
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type routeAdmission struct {
+	matcher   route.Matcher
+	admission *limiting.Admission
+}
+
+// NewDefault is the net/http counterpart of adaptive.PlatoMiddlewareGinDefault
+func NewDefault(threshold float64, opts ...config.OptionFunc) func(http.Handler) http.Handler {
+	return New(limiting.NewPidLimitingHttpDefault(threshold, opts...))
+}
+
+// Handler wraps a single handler, eg. mux.Handle("/api", httpmw.Handler(limit, api))
+func Handler(limit limiting.RateLimit, h http.Handler, opts ...Option) http.Handler {
+	return New(limit, opts...)(h)
+}
+
+func (o *options) reject(w http.ResponseWriter, r *http.Request, info limiting.RejectInfo) {
+	if info.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(info.RetryAfter/time.Second)))
+	}
+	if o.rejectHandler != nil {
+		o.rejectHandler.ServeHTTP(w, r)
+		return
+	}
+	var buf bytes.Buffer
+	if err := o.rejectBody.Execute(&buf, info); err != nil {
+		buf.Reset()
+	}
+	w.Header().Set("Content-Type", o.rejectContentType)
+	w.WriteHeader(o.rejectStatus)
+	_, _ = w.Write(buf.Bytes())
+}
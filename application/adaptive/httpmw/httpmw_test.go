@@ -0,0 +1,195 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package httpmw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/bytedance/pid_limits/application/adaptive/route"
+	"github.com/stretchr/testify/assert"
+)
+
+type tierLimit struct{}
+
+func (l *tierLimit) Limit() bool {
+	return true
+}
+
+func (l *tierLimit) LimitRatio() float64 {
+	return 10000
+}
+
+func (l *tierLimit) LimitWithPriority(p limiting.Priority) bool {
+	return p < limiting.PriorityCritical
+}
+
+type shadowLimit struct{ tierLimit }
+
+func (l *shadowLimit) LimitShadow() (bool, bool) {
+	return false, true
+}
+
+func (l *shadowLimit) LimitWithPriorityShadow(p limiting.Priority) (bool, bool) {
+	return false, l.LimitWithPriority(p)
+}
+
+type trackedLimit struct {
+	admitted  int
+	completed int
+}
+
+func (l *trackedLimit) Limit() bool {
+	l.admitted++
+	return false
+}
+
+func (l *trackedLimit) Acquire() bool {
+	return l.Limit()
+}
+
+func (l *trackedLimit) LimitRatio() float64 {
+	return 0
+}
+
+func (l *trackedLimit) Complete(rt time.Duration) {
+	l.completed++
+}
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+type ctxKey struct{}
+
+func TestNew(t *testing.T) {
+	h := New(&tierLimit{}, WithPriorityContextKey(ctxKey{}), WithPriorityHeader(DefaultPriorityHeader),
+		WithRejectStatus(http.StatusServiceUnavailable), WithRejectText("busy {{.Ratio}}"))(ok)
+
+	w := serve(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "busy 10000", w.Body.String())
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(DefaultPriorityHeader, "critical")
+	assert.Equal(t, http.StatusOK, serve(h, req).Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(DefaultPriorityHeader, "critical")
+	req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, limiting.PriorityBatch))
+	assert.Equal(t, http.StatusServiceUnavailable, serve(h, req).Code)
+}
+
+func TestRejectHandler(t *testing.T) {
+	h := Handler(&tierLimit{}, ok, WithRejectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})))
+	assert.Equal(t, http.StatusTeapot, serve(h, httptest.NewRequest(http.MethodGet, "/", nil)).Code)
+}
+
+func TestCompleter(t *testing.T) {
+	l := &trackedLimit{}
+	mux := http.NewServeMux()
+	mux.Handle("/", ok)
+	h := New(l, WithTenantClientIP())(mux)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve(h, httptest.NewRequest(http.MethodGet, "/", nil)).Code)
+	}
+	assert.Equal(t, 3, l.admitted)
+	assert.Equal(t, 3, l.completed)
+}
+
+func TestCompleterPanic(t *testing.T) {
+	l := &trackedLimit{}
+	h := New(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.Panics(t, func() {
+		serve(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	assert.Equal(t, 1, l.completed)
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Real-IP", "10.0.0.2")
+	req.Header.Set("X-Forwarded-For", "10.0.0.3, 10.0.0.4")
+	// the forwarding headers of untrusted clients are ignored
+	assert.Equal(t, "10.0.0.1", clientIP(nil)(req))
+	assert.Equal(t, "10.0.0.1", clientIP(parseProxies([]string{"192.168.0.0/16"}))(req))
+
+	assert.Equal(t, "10.0.0.4", clientIP(parseProxies([]string{"10.0.0.1"}))(req))
+	assert.Equal(t, "10.0.0.3", clientIP(parseProxies([]string{"10.0.0.0/24"}))(req))
+	req.Header.Del("X-Forwarded-For")
+	assert.Equal(t, "10.0.0.2", clientIP(parseProxies([]string{"10.0.0.1"}))(req))
+
+	assert.Panics(t, func() { WithTenantClientIP("proxy") })
+}
+
+func TestRoutes(t *testing.T) {
+	l := &trackedLimit{}
+	h := New(&tierLimit{}, WithExclude(route.Exact("/health")), WithRouteLimit(l, route.Prefix("/static/")))(ok)
+	assert.Equal(t, http.StatusOK, serve(h, httptest.NewRequest(http.MethodGet, "/health", nil)).Code)
+	assert.Equal(t, http.StatusOK, serve(h, httptest.NewRequest(http.MethodGet, "/static/a.js", nil)).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(h, httptest.NewRequest(http.MethodGet, "/api", nil)).Code)
+	assert.Equal(t, 1, l.completed)
+}
+
+func TestDryRun(t *testing.T) {
+	h := New(&shadowLimit{}, WithDryRunHeader("X-Shadow"), WithPriorityHeader(DefaultPriorityHeader))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ShadowRejected(r) {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := serve(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Shadow"))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(DefaultPriorityHeader, "critical")
+	w = serve(h, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Header().Get("X-Shadow"))
+}
+
+func TestPriorityExtractor(t *testing.T) {
+	h := New(&tierLimit{}, WithPriorityExtractor(func(r *http.Request) (limiting.Priority, bool) {
+		return limiting.PriorityCritical, r.URL.Path == "/vip"
+	}))(ok)
+
+	assert.Equal(t, http.StatusOK, serve(h, httptest.NewRequest(http.MethodGet, "/vip", nil)).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(h, httptest.NewRequest(http.MethodGet, "/other", nil)).Code)
+
+	// the header is not trusted unless enabled
+	req := httptest.NewRequest(http.MethodGet, "/other", nil)
+	req.Header.Set(DefaultPriorityHeader, "critical")
+	assert.Equal(t, http.StatusTooManyRequests, serve(h, req).Code)
+}
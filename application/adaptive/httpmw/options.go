@@ -0,0 +1,292 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package httpmw
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/bytedance/pid_limits/application/adaptive/route"
+)
+
+const (
+	// DefaultPriorityHeader is not read unless enabled by WithPriorityHeader, any client could claim a tier by it
+	DefaultPriorityHeader = "X-Request-Priority"
+	// DefaultDryRunHeader is set on responses of requests a dry-run limiter would have rejected
+	DefaultDryRunHeader  = "X-Plato-Shadow-Reject"
+	defaultRejectStatus  = http.StatusTooManyRequests
+	defaultRejectBody    = "block by pid"
+	defaultMaxRetryAfter = 10 * time.Second
+)
+
+type options struct {
+	priorityHeader     string
+	priorityContextKey interface{}
+	priorityFunc       func(r *http.Request) (limiting.Priority, bool)
+	tenant             func(r *http.Request) string
+	rejectStatus       int
+	maxRetryAfter      time.Duration
+	rejectContentType  string
+	rejectBody         *template.Template
+	rejectHandler      http.Handler
+	filter             route.Filter
+	routes             []routeLimit
+	dryRunHeader       string
+}
+
+type routeLimit struct {
+	matcher route.Matcher
+	limit   limiting.RateLimit
+}
+
+type Option func(*options)
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		rejectStatus:      defaultRejectStatus,
+		maxRetryAfter:     defaultMaxRetryAfter,
+		dryRunHeader:      DefaultDryRunHeader,
+		rejectContentType: "text/plain; charset=utf-8",
+		rejectBody:        template.Must(template.New("reject").Parse(defaultRejectBody)),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithPriorityHeader reads the request tier, eg. "batch" or "2", from header, eg. DefaultPriorityHeader. Only enable
+// it for trusted callers or behind a proxy that overwrites the header, otherwise anyone can skip shedding as critical
+func WithPriorityHeader(header string) Option {
+	return func(o *options) {
+		o.priorityHeader = header
+	}
+}
+
+// WithPriorityContextKey sets the request context key carrying the request tier, the value can be a
+// limiting.Priority or a string, it takes precedence over the header
+func WithPriorityContextKey(key interface{}) Option {
+	return func(o *options) {
+		o.priorityContextKey = key
+	}
+}
+
+// WithPriorityExtractor sets a custom source of the request tier, eg. tiers by route from a config file,
+// it is consulted after the context key and before the header
+func WithPriorityExtractor(f func(r *http.Request) (limiting.Priority, bool)) Option {
+	return func(o *options) {
+		o.priorityFunc = f
+	}
+}
+
+// WithTenantHeader enables tenant fair shedding, the tenant is read from the header
+func WithTenantHeader(header string) Option {
+	return WithTenantExtractor(func(r *http.Request) string {
+		return r.Header.Get(header)
+	})
+}
+
+// WithTenantClientIP enables tenant fair shedding, every client ip is a tenant.
+// The ip is the remote address of the connection, X-Forwarded-For and X-Real-IP can be forged by any client and are only
+// honoured when the remote address is one of trustedProxies, ips or cidrs such as "10.0.0.0/8".
+// it panics if a trusted proxy cannot be parsed
+func WithTenantClientIP(trustedProxies ...string) Option {
+	return WithTenantExtractor(clientIP(parseProxies(trustedProxies)))
+}
+
+// WithTenantExtractor enables tenant fair shedding with a custom tenant key. Requests with an empty key skip the fair
+// share, they are shed by the ratio of the limiter, spread across the tiers for the requests with a priority.
+// it has no effect on limiters implementing limiting.Completer, eg. BBRLimiting
+func WithTenantExtractor(f func(r *http.Request) string) Option {
+	return func(o *options) {
+		o.tenant = f
+	}
+}
+
+// WithDryRunHeader sets the response header marking requests a dry-run limiter would have rejected,
+// an empty name disables it
+func WithDryRunHeader(header string) Option {
+	return func(o *options) {
+		o.dryRunHeader = header
+	}
+}
+
+type shadowRejectKey struct{}
+
+// ShadowRejected reports whether a dry-run limiter would have rejected the request
+func ShadowRejected(r *http.Request) bool {
+	rejected, _ := r.Context().Value(shadowRejectKey{}).(bool)
+	return rejected
+}
+
+func (o *options) shadowReject(w http.ResponseWriter, r *http.Request) *http.Request {
+	if o.dryRunHeader != "" {
+		w.Header().Set(o.dryRunHeader, "1")
+	}
+	return r.WithContext(context.WithValue(r.Context(), shadowRejectKey{}, true))
+}
+
+// WithRejectStatus sets the status code of rejected requests, 429 by default, 503 is the other common choice
+func WithRejectStatus(status int) Option {
+	return func(o *options) {
+		o.rejectStatus = status
+	}
+}
+
+// WithRetryAfter sets the upper bound of the Retry-After header, it grows with the reject ratio from one second to max,
+// 0 disables the header
+func WithRetryAfter(max time.Duration) Option {
+	return func(o *options) {
+		o.maxRetryAfter = max
+	}
+}
+
+// WithRejectBody sets the body of rejected requests, tpl is a text/template executed with the limiting.RejectInfo,
+// eg. `{"code": 429, "ratio": {{.Ratio}}}`, it panics if tpl cannot be parsed
+func WithRejectBody(contentType string, tpl string) Option {
+	t := template.Must(template.New("reject").Parse(tpl))
+	return func(o *options) {
+		o.rejectContentType = contentType
+		o.rejectBody = t
+	}
+}
+
+// WithRejectJSON is WithRejectBody with a json content type
+func WithRejectJSON(tpl string) Option {
+	return WithRejectBody("application/json; charset=utf-8", tpl)
+}
+
+// WithRejectText is WithRejectBody with a plain text content type
+func WithRejectText(tpl string) Option {
+	return WithRejectBody("text/plain; charset=utf-8", tpl)
+}
+
+// WithRejectHandler replaces the whole rejection response, status and body options are ignored
+func WithRejectHandler(h http.Handler) Option {
+	return func(o *options) {
+		o.rejectHandler = h
+	}
+}
+
+// WithInclude limits only the requests matching one of the matchers, eg. route.Prefix("/api"),
+// net/http has no route pattern, route.FullPath never matches
+func WithInclude(matchers ...route.Matcher) Option {
+	return func(o *options) {
+		o.filter.Include = append(o.filter.Include, matchers...)
+	}
+}
+
+// WithExclude exempts the requests matching one of the matchers from shedding, it wins over WithInclude
+func WithExclude(matchers ...route.Matcher) Option {
+	return func(o *options) {
+		o.filter.Exclude = append(o.filter.Exclude, matchers...)
+	}
+}
+
+// WithRouteLimit gives the requests matching one of the matchers their own limiter, routes are tried in the order
+// they are added and the limiter passed to New applies to everything else
+func WithRouteLimit(limit limiting.RateLimit, matchers ...route.Matcher) Option {
+	return func(o *options) {
+		o.routes = append(o.routes, routeLimit{matcher: route.Any(matchers...), limit: limit})
+	}
+}
+
+func (o *options) priority(r *http.Request) (limiting.Priority, bool) {
+	if o.priorityContextKey != nil {
+		switch p := r.Context().Value(o.priorityContextKey).(type) {
+		case limiting.Priority:
+			return p, true
+		case string:
+			return limiting.ParsePriority(p)
+		}
+	}
+	if o.priorityFunc != nil {
+		if p, ok := o.priorityFunc(r); ok {
+			return p, true
+		}
+	}
+	if o.priorityHeader != "" {
+		if v := r.Header.Get(o.priorityHeader); v != "" {
+			return limiting.ParsePriority(v)
+		}
+	}
+	return limiting.PriorityDefault, false
+}
+
+// clientIP is the remote address of the connection, the forwarding headers are only read when it is a trusted proxy.
+// X-Forwarded-For is walked from the right and the first address that is not a trusted proxy is the client
+func clientIP(trusted []*net.IPNet) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		remote, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+		if err != nil {
+			remote = strings.TrimSpace(r.RemoteAddr)
+		}
+		if !trustedProxy(trusted, remote) {
+			return remote
+		}
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			ips := strings.Split(strings.Join(forwarded, ","), ",")
+			for i := len(ips) - 1; i >= 0; i-- {
+				ip := strings.TrimSpace(ips[i])
+				if ip != "" && (i == 0 || !trustedProxy(trusted, ip)) {
+					return ip
+				}
+			}
+		}
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+		return remote
+	}
+}
+
+func trustedProxy(trusted []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseProxies(proxies []string) []*net.IPNet {
+	trusted := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if _, n, err := net.ParseCIDR(proxy); err == nil {
+			trusted = append(trusted, n)
+			continue
+		}
+		ip := net.ParseIP(proxy)
+		if ip == nil {
+			panic("httpmw: invalid trusted proxy " + proxy)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return trusted
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package limiting
+
+import (
+	"time"
+
+	"github.com/bytedance/pid_limits/metrics/system/cpu"
+)
+
+// tenantShadowLimit is implemented by TenantLimiting, it spreads the tenant ratio across the priority tiers
+// and reports the shadow rejects of a wrapped limiter in dry-run mode
+type tenantShadowLimit interface {
+	LimitTenantShadow(tenant string, p Priority) (reject bool, wouldReject bool)
+	limitTenantShadow(tenant string) (reject bool, wouldReject bool)
+}
+
+// Admission makes the admission decision of a request with the optional capabilities of a limiter,
+// it is shared by the middlewares of every framework
+type Admission struct {
+	limit     RateLimit
+	completer Completer
+	priority  PriorityLimit
+	tenant    TenantLimit
+	shadow    ShadowLimit
+}
+
+// NewAdmission inspects limit once, when tenantAware is set a limiter without tenant support is wrapped
+// by a TenantLimiting, unless it implements Completer and has to decide its admission itself
+func NewAdmission(limit RateLimit, tenantAware bool) *Admission {
+	a := &Admission{limit: limit}
+	a.completer, _ = limit.(Completer)
+	a.priority, _ = limit.(PriorityLimit)
+	a.shadow, _ = limit.(ShadowLimit)
+	if tenantAware && a.completer == nil {
+		if a.tenant, _ = limit.(TenantLimit); a.tenant == nil {
+			a.tenant = NewTenantLimiting(limit)
+		}
+	}
+	return a
+}
+
+// Limit decides whether a request should be rejected. A request with a tenant is shed by the fair share of the
+// tenant, and a limiter supporting tiers spreads the ratio across the priorities of the requests with a tier.
+// A request without a tier is shed by the plain ratio, so untagged traffic sheds what the limiter reports.
+// wouldReject reports a rejection skipped by a limiter in dry-run mode
+func (a *Admission) Limit(p Priority, hasPriority bool, tenant string) (reject bool, wouldReject bool) {
+	if a.completer != nil {
+		return a.completer.Acquire(), false
+	}
+	if tenant != "" && a.tenant != nil {
+		if t, ok := a.tenant.(tenantShadowLimit); ok {
+			if !hasPriority {
+				return t.limitTenantShadow(tenant)
+			}
+			return t.LimitTenantShadow(tenant, p)
+		}
+		return a.tenant.LimitTenant(tenant), false
+	}
+	if a.priority != nil && hasPriority {
+		if a.shadow != nil {
+			return a.shadow.LimitWithPriorityShadow(p)
+		}
+		return a.priority.LimitWithPriority(p), false
+	}
+	if a.shadow != nil {
+		return a.shadow.LimitShadow()
+	}
+	return a.limit.Limit(), false
+}
+
+// Tracked reports whether Complete has to be called for admitted requests, Limit acquired them
+func (a *Admission) Tracked() bool {
+	return a.completer != nil
+}
+
+func (a *Admission) Complete(rt time.Duration) {
+	if a.completer != nil {
+		a.completer.Complete(rt)
+	}
+}
+
+// RejectInfo snapshots the limiter for a rejected request
+func (a *Admission) RejectInfo(maxRetryAfter time.Duration) RejectInfo {
+	ratio := a.limit.LimitRatio()
+	return RejectInfo{
+		CPUUsage:   cpu.GetUsage(),
+		Ratio:      ratio,
+		RetryAfter: RetryAfter(ratio, maxRetryAfter),
+	}
+}
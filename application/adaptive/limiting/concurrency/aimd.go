@@ -0,0 +1,49 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package concurrency
+
+import (
+	"math"
+	"time"
+)
+
+// AIMD increases the limit by one while the limit is being used, and backs off multiplicatively on drops or timeouts
+type AIMD struct {
+	*limiter
+	timeout      time.Duration
+	backoffRatio float64
+}
+
+func NewAIMD(opts ...OptionFunc) *AIMD {
+	option := newOptions(opts)
+	a := &AIMD{
+		timeout:      option.Timeout,
+		backoffRatio: option.BackoffRatio,
+	}
+	a.limiter = newLimiter(a, option)
+	return a
+}
+
+func (a *AIMD) update(limit float64, rtt time.Duration, inflight int, dropped bool) float64 {
+	if dropped || rtt > a.timeout {
+		return math.Floor(limit * a.backoffRatio)
+	}
+	// only grow when the limit is actually used, otherwise the limit drifts up without any evidence
+	if float64(inflight)*2 >= limit {
+		return limit + 1
+	}
+	return limit
+}
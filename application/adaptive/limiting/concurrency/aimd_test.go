@@ -0,0 +1,45 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package concurrency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAIMD(t *testing.T) {
+	a := NewAIMD(WithInitialLimit(10), WithTimeout(time.Second), WithBackoffRatio(0.5))
+
+	// app limited, the limit stays
+	a.onSample(10*time.Millisecond, 1, false)
+	assert.Equal(t, 10, a.Limit())
+
+	a.onSample(10*time.Millisecond, 5, false)
+	assert.Equal(t, 11, a.Limit())
+
+	a.onSample(10*time.Millisecond, 5, true)
+	assert.Equal(t, 5, a.Limit())
+
+	a.onSample(2*time.Second, 5, false)
+	assert.Equal(t, 2, a.Limit())
+
+	for i := 0; i < 10; i++ {
+		a.onSample(2*time.Second, 5, false)
+	}
+	assert.Equal(t, 1, a.Limit())
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package concurrency
+
+import (
+	"math"
+	"time"
+)
+
+// Gradient2 compares a short term rtt (the latest sample) with a long term exponential average of rtt,
+// the ratio between them is the gradient used to shrink or grow the limit
+type Gradient2 struct {
+	*limiter
+	smoothing  float64
+	tolerance  float64
+	longWindow int
+	longRtt    float64
+	samples    int
+}
+
+func NewGradient2(opts ...OptionFunc) *Gradient2 {
+	option := newOptions(opts)
+	g := &Gradient2{
+		smoothing:  option.Smoothing,
+		tolerance:  option.Tolerance,
+		longWindow: option.LongWindow,
+	}
+	g.limiter = newLimiter(g, option)
+	return g
+}
+
+func (g *Gradient2) update(limit float64, rtt time.Duration, inflight int, dropped bool) float64 {
+	if rtt <= 0 {
+		return limit
+	}
+	shortRtt := float64(rtt)
+	g.updateLongRtt(shortRtt)
+
+	// the limit is not used, do not grow it
+	if float64(inflight)*2 < limit && !dropped {
+		return limit
+	}
+	gradient := math.Max(0.5, math.Min(1.0, g.tolerance*g.longRtt/shortRtt))
+	if dropped {
+		gradient = 0.5
+	}
+	queueSize := math.Sqrt(limit)
+	newLimit := limit*gradient + queueSize
+	return limit*(1-g.smoothing) + newLimit*g.smoothing
+}
+
+func (g *Gradient2) updateLongRtt(shortRtt float64) {
+	if g.samples < g.longWindow {
+		// warm up with a plain average until the window is filled
+		g.samples++
+		g.longRtt += (shortRtt - g.longRtt) / float64(g.samples)
+	} else {
+		factor := 2.0 / float64(g.longWindow+1)
+		g.longRtt = g.longRtt*(1-factor) + shortRtt*factor
+	}
+	// the long rtt follows a steady increase too slowly, decay it so the limit can recover
+	if g.longRtt/shortRtt > 2 {
+		g.longRtt *= 0.95
+	}
+}
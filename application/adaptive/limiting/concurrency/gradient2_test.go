@@ -0,0 +1,55 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package concurrency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGradient2(t *testing.T) {
+	g := NewGradient2(WithInitialLimit(100), WithLongWindow(10), WithSmoothing(1), WithTolerance(1))
+
+	for i := 0; i < 10; i++ {
+		g.onSample(10*time.Millisecond, 100, false)
+	}
+	// gradient is 1, the limit grows by its square root
+	assert.True(t, g.Limit() > 100)
+
+	before := g.Limit()
+	g.onSample(40*time.Millisecond, before, false)
+	assert.True(t, g.Limit() < before)
+
+	before = g.Limit()
+	g.onSample(10*time.Millisecond, 1, false)
+	assert.Equal(t, before, g.Limit())
+
+	g.onSample(10*time.Millisecond, 1, true)
+	assert.True(t, g.Limit() < before)
+}
+
+func TestGradient2SubMillisecond(t *testing.T) {
+	g := NewGradient2(WithInitialLimit(20), WithLongWindow(10))
+	for i := 0; i < 10; i++ {
+		g.onSample(200*time.Microsecond, 20, false)
+	}
+	before := g.Limit()
+	// the rtt quadrupled, still below a millisecond
+	g.onSample(800*time.Microsecond, before, false)
+	assert.True(t, g.Limit() < before)
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package concurrency
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/pid_limits"
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+)
+
+/**
+adaptive concurrency limiters, the limit of in-flight requests is adjusted by the measured rtt instead of the cpu usage,
+which protects services whose bottleneck is a downstream dependency rather than the local cpu
+*/
+
+// Limiter is the acquire/release contract shared by Vegas, Gradient2 and AIMD.
+// Every token returned by a successful Acquire must be finished by Release, Drop or Ignore
+type Limiter interface {
+	Acquire() (*Token, bool)
+	Limit() int
+	Inflight() int
+}
+
+// Token represents one admitted request
+type Token struct {
+	l        *limiter
+	start    time.Time
+	inflight int
+	done     uint32
+}
+
+// Release reports the request succeeded, its rtt is used as a sample
+func (t *Token) Release() {
+	t.finish(func() {
+		t.l.onSample(time.Since(t.start), t.inflight, false)
+	})
+}
+
+// Drop reports the request failed because of overload, eg. timeout, the limit will be decreased
+func (t *Token) Drop() {
+	t.finish(func() {
+		t.l.onSample(time.Since(t.start), t.inflight, true)
+	})
+}
+
+// Ignore releases the slot without feeding a sample into the algorithm
+func (t *Token) Ignore() {
+	t.finish(nil)
+}
+
+func (t *Token) finish(sample func()) {
+	if !atomic.CompareAndSwapUint32(&t.done, 0, 1) {
+		return
+	}
+	atomic.AddInt64(&t.l.inflight, -1)
+	if sample != nil {
+		sample()
+	}
+}
+
+// algorithm computes the next limit from a sample, it is always called with the limiter lock held
+type algorithm interface {
+	update(limit float64, rtt time.Duration, inflight int, dropped bool) float64
+}
+
+type limiter struct {
+	mu       sync.Mutex
+	alg      algorithm
+	min, max float64
+	estimate float64
+	limit    int64
+	inflight int64
+}
+
+func newLimiter(alg algorithm, option *Options) *limiter {
+	return &limiter{
+		alg:      alg,
+		min:      float64(option.MinLimit),
+		max:      float64(option.MaxLimit),
+		estimate: float64(option.InitialLimit),
+		limit:    int64(option.InitialLimit),
+	}
+}
+
+// Acquire admits a request while the in-flight requests are below the limit, or while limiting.DisableAll is in effect
+func (l *limiter) Acquire() (*Token, bool) {
+	inflight, ok := l.acquire()
+	if !ok {
+		return nil, false
+	}
+	return &Token{l: l, start: time.Now(), inflight: inflight}, true
+}
+
+// acquire counts the request in flight if it is admitted, past the limit while limiting.DisableAll is in effect
+func (l *limiter) acquire() (int, bool) {
+	if inflight, ok := l.tryAcquire(); ok {
+		return inflight, true
+	}
+	if !limiting.AllDisabled() {
+		return 0, false
+	}
+	return int(atomic.AddInt64(&l.inflight, 1)), true
+}
+
+func (l *limiter) tryAcquire() (int, bool) {
+	for {
+		inflight := atomic.LoadInt64(&l.inflight)
+		if inflight >= atomic.LoadInt64(&l.limit) {
+			return int(inflight), false
+		}
+		if atomic.CompareAndSwapInt64(&l.inflight, inflight, inflight+1) {
+			return int(inflight + 1), true
+		}
+	}
+}
+
+func (l *limiter) Limit() int {
+	return int(atomic.LoadInt64(&l.limit))
+}
+
+func (l *limiter) Inflight() int {
+	return int(atomic.LoadInt64(&l.inflight))
+}
+
+// Decide implements plato.RuleInterface, so a limiter can be set as the Rule of a PlatoEntry.
+// Like Acquire it admits every request while limiting.DisableAll is in effect
+func (l *limiter) Decide(ctx *plato.EntryCtx) bool {
+	_, ok := l.acquire()
+	return ok
+}
+
+// OnExit implements plato.ExitListener, it is called by PlatoEntry.Exit for requests admitted by Decide
+func (l *limiter) OnExit(ctx *plato.EntryCtx, rtt time.Duration) {
+	inflight := atomic.AddInt64(&l.inflight, -1) + 1
+	l.onSample(rtt, int(inflight), false)
+}
+
+func (l *limiter) onSample(rtt time.Duration, inflight int, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	estimate := l.alg.update(l.estimate, rtt, inflight, dropped)
+	l.estimate = math.Max(l.min, math.Min(l.max, estimate))
+	atomic.StoreInt64(&l.limit, int64(l.estimate))
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package concurrency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bytedance/pid_limits"
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterAcquire(t *testing.T) {
+	l := NewAIMD(WithInitialLimit(2))
+	t1, ok := l.Acquire()
+	assert.True(t, ok)
+	t2, ok := l.Acquire()
+	assert.True(t, ok)
+	_, ok = l.Acquire()
+	assert.False(t, ok)
+	assert.Equal(t, 2, l.Inflight())
+
+	t1.Ignore()
+	// finishing a token twice must not release two slots
+	t1.Ignore()
+	assert.Equal(t, 1, l.Inflight())
+	t2.Release()
+	assert.Equal(t, 0, l.Inflight())
+}
+
+func TestLimiterDisableAll(t *testing.T) {
+	l := NewAIMD(WithInitialLimit(1))
+	t1, ok := l.Acquire()
+	assert.True(t, ok)
+
+	limiting.DisableAll()
+	t2, ok := l.Acquire()
+	limiting.EnableAll()
+	assert.True(t, ok)
+	assert.Equal(t, 2, l.Inflight())
+	t1.Ignore()
+	t2.Ignore()
+	assert.Equal(t, 0, l.Inflight())
+
+	// the kill switch applies to the Rule of a PlatoEntry too
+	entry := plato.NewPlatoEntry("concurrency-disable-all")
+	entry.Rule = l
+	_, ok = entry.Run(func() error {
+		_, ok := entry.Run(func() error { return nil })
+		assert.False(t, ok)
+		limiting.DisableAll()
+		defer limiting.EnableAll()
+		_, ok = entry.Run(func() error { return nil })
+		assert.True(t, ok)
+		return nil
+	})
+	assert.True(t, ok)
+	assert.Equal(t, 0, l.Inflight())
+}
+
+func TestLimiterWithPlatoEntry(t *testing.T) {
+	l := NewAIMD(WithInitialLimit(1))
+	entry := plato.NewPlatoEntry("concurrency")
+	entry.Rule = l
+
+	e, ok := entry.Run(func() error {
+		assert.Equal(t, 1, l.Inflight())
+		// the only slot is held by the outer call
+		_, ok := entry.Run(func() error { return nil })
+		assert.False(t, ok)
+		time.Sleep(2 * time.Millisecond)
+		return nil
+	})
+	assert.Nil(t, e)
+	assert.True(t, ok)
+	assert.Equal(t, 0, l.Inflight())
+	// the limit was fully used, AIMD grows it by one
+	assert.Equal(t, 2, l.Limit())
+}
+
+func TestNewOptionsClamp(t *testing.T) {
+	option := newOptions([]OptionFunc{WithMinLimit(0), WithMaxLimit(10), WithInitialLimit(100)})
+	assert.Equal(t, 1, option.MinLimit)
+	assert.Equal(t, 10, option.InitialLimit)
+}
+
+func TestLimiterSubMillisecondEntry(t *testing.T) {
+	v := NewVegas(WithInitialLimit(1), WithProbeMultiplier(0))
+	entry := plato.NewPlatoEntry("fast")
+	entry.Rule = v
+	for i := 0; i < 3; i++ {
+		_, ok := entry.Run(func() error { return nil })
+		assert.True(t, ok)
+	}
+	// the rtts are below a millisecond, they still reach the algorithm
+	assert.True(t, v.rttNoLoad > 0 && v.rttNoLoad < time.Millisecond)
+}
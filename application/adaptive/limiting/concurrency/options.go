@@ -0,0 +1,134 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package concurrency
+
+import (
+	"time"
+)
+
+const (
+	defaultInitialLimit = 20
+	defaultMinLimit     = 1
+	defaultMaxLimit     = 1000
+)
+
+type Options struct {
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+	// Timeout is the rtt above which an AIMD sample is treated as a drop
+	Timeout time.Duration
+	// BackoffRatio is the multiplicative decrease factor of AIMD
+	BackoffRatio float64
+	// Smoothing is the weight of a new Gradient2 limit against the current one
+	Smoothing float64
+	// Tolerance is how much the short rtt may exceed the long rtt before Gradient2 decreases
+	Tolerance float64
+	// LongWindow is the number of samples the Gradient2 long-term rtt averages over
+	LongWindow int
+	// ProbeMultiplier controls how often Vegas resets its no-load rtt, in multiples of the limit
+	ProbeMultiplier int
+}
+
+type OptionFunc func(*Options)
+
+func NewOptions() *Options {
+	return &Options{
+		InitialLimit:    defaultInitialLimit,
+		MinLimit:        defaultMinLimit,
+		MaxLimit:        defaultMaxLimit,
+		Timeout:         5 * time.Second,
+		BackoffRatio:    0.9,
+		Smoothing:       0.2,
+		Tolerance:       1.5,
+		LongWindow:      600,
+		ProbeMultiplier: 30,
+	}
+}
+
+func WithInitialLimit(limit int) OptionFunc {
+	return func(options *Options) {
+		options.InitialLimit = limit
+	}
+}
+
+func WithMinLimit(limit int) OptionFunc {
+	return func(options *Options) {
+		options.MinLimit = limit
+	}
+}
+
+func WithMaxLimit(limit int) OptionFunc {
+	return func(options *Options) {
+		options.MaxLimit = limit
+	}
+}
+
+func WithTimeout(timeout time.Duration) OptionFunc {
+	return func(options *Options) {
+		options.Timeout = timeout
+	}
+}
+
+func WithBackoffRatio(ratio float64) OptionFunc {
+	return func(options *Options) {
+		options.BackoffRatio = ratio
+	}
+}
+
+func WithSmoothing(smoothing float64) OptionFunc {
+	return func(options *Options) {
+		options.Smoothing = smoothing
+	}
+}
+
+func WithTolerance(tolerance float64) OptionFunc {
+	return func(options *Options) {
+		options.Tolerance = tolerance
+	}
+}
+
+func WithLongWindow(window int) OptionFunc {
+	return func(options *Options) {
+		options.LongWindow = window
+	}
+}
+
+func WithProbeMultiplier(multiplier int) OptionFunc {
+	return func(options *Options) {
+		options.ProbeMultiplier = multiplier
+	}
+}
+
+func newOptions(opts []OptionFunc) *Options {
+	option := NewOptions()
+	for _, opt := range opts {
+		opt(option)
+	}
+	if option.MinLimit < 1 {
+		option.MinLimit = 1
+	}
+	if option.MaxLimit < option.MinLimit {
+		option.MaxLimit = option.MinLimit
+	}
+	if option.InitialLimit < option.MinLimit {
+		option.InitialLimit = option.MinLimit
+	}
+	if option.InitialLimit > option.MaxLimit {
+		option.InitialLimit = option.MaxLimit
+	}
+	return option
+}
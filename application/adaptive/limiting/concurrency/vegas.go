@@ -0,0 +1,79 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package concurrency
+
+import (
+	"math"
+	"time"
+)
+
+// Vegas estimates the queue size from the gap between the no-load rtt and the current rtt, like TCP Vegas,
+// and keeps the estimated queue between alpha and beta
+type Vegas struct {
+	*limiter
+	rttNoLoad       time.Duration
+	probeMultiplier int
+	probeCount      int
+}
+
+func NewVegas(opts ...OptionFunc) *Vegas {
+	option := newOptions(opts)
+	v := &Vegas{
+		probeMultiplier: option.ProbeMultiplier,
+	}
+	v.limiter = newLimiter(v, option)
+	return v
+}
+
+func log10Root(limit float64) float64 {
+	return math.Max(1, math.Log10(limit))
+}
+
+func (v *Vegas) update(limit float64, rtt time.Duration, inflight int, dropped bool) float64 {
+	if rtt <= 0 {
+		return limit
+	}
+	// probe the no-load rtt again from time to time, the real one may have risen, eg. after a dependency migrated
+	v.probeCount++
+	if v.probeMultiplier > 0 && v.probeCount > v.probeMultiplier*int(limit) {
+		v.probeCount = 0
+		v.rttNoLoad = rtt
+		return limit
+	}
+	if v.rttNoLoad == 0 || rtt < v.rttNoLoad {
+		v.rttNoLoad = rtt
+		return limit
+	}
+
+	step := log10Root(limit)
+	if dropped {
+		return limit - step
+	}
+	if float64(inflight)*2 < limit {
+		return limit
+	}
+	queueSize := math.Ceil(limit * (1 - float64(v.rttNoLoad)/float64(rtt)))
+	alpha, beta := 3*step, 6*step
+	switch {
+	case queueSize <= step:
+		return limit + beta
+	case queueSize < alpha:
+		return limit + step
+	case queueSize > beta:
+		return limit - step
+	}
+	return limit
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package concurrency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVegas(t *testing.T) {
+	v := NewVegas(WithInitialLimit(10), WithProbeMultiplier(0))
+
+	// the first sample sets the no-load rtt
+	v.onSample(10*time.Millisecond, 10, false)
+	assert.Equal(t, 10, v.Limit())
+
+	// no queueing, grow by beta
+	v.onSample(10*time.Millisecond, 10, false)
+	assert.Equal(t, 16, v.Limit())
+
+	// rtt doubled, half of the limit is queueing, shrink
+	v.onSample(20*time.Millisecond, 16, false)
+	assert.Equal(t, 14, v.Limit())
+
+	v.onSample(20*time.Millisecond, 14, true)
+	assert.Equal(t, 13, v.Limit())
+
+	// app limited
+	v.onSample(10*time.Millisecond, 1, false)
+	assert.Equal(t, 13, v.Limit())
+}
+
+func TestVegasProbe(t *testing.T) {
+	v := NewVegas(WithInitialLimit(1), WithProbeMultiplier(1))
+	v.onSample(10*time.Millisecond, 1, false)
+	v.onSample(30*time.Millisecond, 1, false)
+	assert.Equal(t, 30*time.Millisecond, v.rttNoLoad)
+}
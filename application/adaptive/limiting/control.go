@@ -0,0 +1,131 @@
+package limiting
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/pid_limits/util/logging"
+)
+
+// Override is a reject ratio forced on a registered limiter by ForceRatio
+type Override struct {
+	Name string
+	// Ratio is the forced reject ratio, 0 ~ 10000
+	Ratio   float64
+	Expires time.Time
+}
+
+// control is the process-wide kill switch and the forced ratios of the registered limiters,
+// forced counts the overrides so the limiters skip the lock when there is none
+var control = struct {
+	disabled  int32
+	forced    int32
+	mu        sync.RWMutex
+	overrides map[string]*Override
+}{overrides: map[string]*Override{}}
+
+// DisableAll stops the shedding of every registered limiter until EnableAll, it takes precedence over ForceRatio
+func DisableAll() {
+	if atomic.CompareAndSwapInt32(&control.disabled, 0, 1) {
+		logging.Warn("all limiters disabled")
+	}
+}
+
+// EnableAll resumes the shedding stopped by DisableAll
+func EnableAll() {
+	if atomic.CompareAndSwapInt32(&control.disabled, 1, 0) {
+		logging.Warn("all limiters enabled")
+	}
+}
+
+// AllDisabled reports whether DisableAll is in effect
+func AllDisabled() bool {
+	return atomic.LoadInt32(&control.disabled) == 1
+}
+
+// ForceRatio makes the limiter registered under name reject the given ratio, 0 ~ 10000, of the requests whatever
+// its cpu usage, until the ttl expires or ClearRatio is called. A new call replaces the previous override
+func ForceRatio(name string, ratio float64, ttl time.Duration) error {
+	if !(ratio >= 0 && ratio <= 10000) {
+		return fmt.Errorf("limiting: forced ratio should be in 0 ~ 10000, got %v", ratio)
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("limiting: forced ratio ttl should be > 0, got %v", ttl)
+	}
+	if _, ok := Lookup(name); !ok {
+		return fmt.Errorf("limiting: no limiter registered under %q", name)
+	}
+	o := &Override{Name: name, Ratio: ratio, Expires: time.Now().Add(ttl)}
+	control.mu.Lock()
+	if _, ok := control.overrides[name]; !ok {
+		atomic.AddInt32(&control.forced, 1)
+	}
+	control.overrides[name] = o
+	control.mu.Unlock()
+	time.AfterFunc(ttl, func() {
+		if clearOverride(name, o) {
+			logging.Warn("forced ratio expired", "name", name, "ratio", ratio)
+		}
+	})
+	logging.Warn("forced ratio", "name", name, "ratio", ratio, "ttl", ttl)
+	return nil
+}
+
+// ClearRatio removes the override of the limiter registered under name, it reports whether there was one
+func ClearRatio(name string) bool {
+	if clearOverride(name, nil) {
+		logging.Warn("forced ratio cleared", "name", name)
+		return true
+	}
+	return false
+}
+
+// Overrides returns the overrides in effect sorted by name
+func Overrides() []Override {
+	now := time.Now()
+	control.mu.RLock()
+	overrides := make([]Override, 0, len(control.overrides))
+	for _, o := range control.overrides {
+		if now.Before(o.Expires) {
+			overrides = append(overrides, *o)
+		}
+	}
+	control.mu.RUnlock()
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].Name < overrides[j].Name
+	})
+	return overrides
+}
+
+// clearOverride removes the override of name, only if it is still o when o is not nil
+func clearOverride(name string, o *Override) bool {
+	control.mu.Lock()
+	defer control.mu.Unlock()
+	current, ok := control.overrides[name]
+	if !ok || (o != nil && current != o) {
+		return false
+	}
+	delete(control.overrides, name)
+	atomic.AddInt32(&control.forced, -1)
+	return true
+}
+
+// override returns the reject ratio imposed on the limiter registered under name, 0 while DisableAll is in effect
+func override(name string) (float64, bool) {
+	if atomic.LoadInt32(&control.disabled) == 1 {
+		return 0, true
+	}
+	if atomic.LoadInt32(&control.forced) == 0 {
+		return 0, false
+	}
+	control.mu.RLock()
+	o, ok := control.overrides[name]
+	control.mu.RUnlock()
+	if !ok || !time.Now().Before(o.Expires) {
+		return 0, false
+	}
+	return o.Ratio, true
+}
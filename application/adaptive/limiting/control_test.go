@@ -0,0 +1,83 @@
+package limiting
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisableAll(t *testing.T) {
+	l := &PIDLimiting{name: "control-disable", rate: 10000, monitor: &fakeMonitor{overload: true}}
+	Register(l.name, l)
+	defer Unregister(l.name)
+	assert.True(t, l.Limit())
+
+	DisableAll()
+	assert.True(t, AllDisabled())
+	assert.False(t, l.Limit())
+	assert.Equal(t, float64(0), l.LimitRatio())
+	// the kill switch takes precedence over a forced ratio
+	assert.NoError(t, ForceRatio(l.name, 10000, time.Minute))
+	assert.False(t, l.Limit())
+	ClearRatio(l.name)
+
+	EnableAll()
+	assert.False(t, AllDisabled())
+	assert.True(t, l.Limit())
+}
+
+func TestForceRatio(t *testing.T) {
+	l := &PIDLimiting{name: "control-force", monitor: &fakeMonitor{}}
+	Register(l.name, l)
+	defer Unregister(l.name)
+
+	assert.Error(t, ForceRatio(l.name, 10001, time.Minute))
+	assert.Error(t, ForceRatio(l.name, 5000, 0))
+	assert.Error(t, ForceRatio("control-missing", 5000, time.Minute))
+	assert.Empty(t, Overrides())
+
+	assert.NoError(t, ForceRatio(l.name, 10000, 50*time.Millisecond))
+	assert.True(t, l.Limit())
+	assert.Equal(t, float64(10000), l.LimitRatio())
+	overrides := Overrides()
+	assert.Len(t, overrides, 1)
+	assert.Equal(t, l.name, overrides[0].Name)
+
+	// the expired override is removed by its timer
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&control.forced) == 0 }, time.Second, 10*time.Millisecond)
+	assert.Empty(t, Overrides())
+	assert.False(t, l.Limit())
+	assert.False(t, ClearRatio(l.name))
+
+	assert.NoError(t, ForceRatio(l.name, 10000, time.Minute))
+	assert.True(t, ClearRatio(l.name))
+	assert.False(t, l.Limit())
+}
+
+func TestForceRatioTenant(t *testing.T) {
+	inner := &PIDLimiting{name: "control-inner", monitor: &fakeMonitor{}}
+	tenants := NewTenantLimiting(inner)
+	defer Unregister(tenants.name)
+
+	assert.NoError(t, ForceRatio(tenants.name, 10000, time.Minute))
+	defer ClearRatio(tenants.name)
+	assert.True(t, tenants.Limit())
+	assert.Equal(t, float64(10000), tenants.LimitRatio())
+	assert.False(t, inner.Limit())
+}
+
+func TestPIDTuneOverride(t *testing.T) {
+	l := &PIDTune{name: "control-tune"}
+	Register(l.name, tuneLimit{l})
+	defer Unregister(l.name)
+
+	assert.Equal(t, uint32(0), l.LimitRatio())
+	assert.NoError(t, ForceRatio(l.name, 10000, time.Minute))
+	defer ClearRatio(l.name)
+	assert.Equal(t, uint32(10000), l.LimitRatio())
+	assert.True(t, l.Limit())
+	registered, _ := Lookup(l.name)
+	assert.Equal(t, float64(10000), registered.LimitRatio())
+}
@@ -16,11 +16,17 @@
 package limiting
 
 import (
+	"fmt"
 	"math"
+	"sync/atomic"
+	"time"
 
 	"github.com/bytedance/pid_limits/application/adaptive/config"
 	"github.com/bytedance/pid_limits/arithmetic/pid"
+	"github.com/bytedance/pid_limits/core/event"
+	"github.com/bytedance/pid_limits/core/stat"
 	"github.com/bytedance/pid_limits/metrics/system/cpu"
+	"github.com/bytedance/pid_limits/util/logging"
 )
 
 // develop to orient interface, use limit() function to determine weather limit cpu rate
@@ -29,6 +35,27 @@ type RateLimit interface {
 	LimitRatio() float64
 }
 
+// ShadowLimit is implemented by limiters supporting dry-run, in dry-run mode nothing is rejected
+// but the decision that would have been made is reported
+type ShadowLimit interface {
+	LimitShadow() (reject bool, wouldReject bool)
+	LimitWithPriorityShadow(p Priority) (reject bool, wouldReject bool)
+}
+
+// shadowDecider is implemented by limiters supporting dry-run, ratio is the reject ratio they would apply
+// and shadow counts a decision, turning it into a shadow reject in dry-run mode
+type shadowDecider interface {
+	ratio() float64
+	shadow(reject bool) (bool, bool)
+}
+
+// Completer is implemented by limiters that need to observe admitted requests finishing. Acquire is Limit counting
+// the admitted request in flight, Complete must be called once for every Acquire() that returned false
+type Completer interface {
+	Acquire() (reject bool)
+	Complete(rt time.Duration)
+}
+
 func NewPidLimitingHttpDefault(cpuThreshold float64, opts ...config.OptionFunc) RateLimit {
 	option := config.NewOptions()
 	for _, opt := range opts {
@@ -40,39 +67,247 @@ func NewPidLimitingHttpDefault(cpuThreshold float64, opts ...config.OptionFunc)
 	return NewPidLimiting(5351.821461335851, 12.030101184005932, 0.03, cpuThreshold, opts...)
 }
 
+// NewPidLimiting is New reporting invalid options instead of failing, an invalid set point is clamped at runtime
 func NewPidLimiting(kp float64, ki float64, kd float64, setPoint float64, opts ...config.OptionFunc) *PIDLimiting {
+	option := pidOptions(kp, ki, kd, setPoint, opts...)
+	if err := option.Validate(); err != nil {
+		logger := option.Logger
+		if logger == nil {
+			logger = logging.Default()
+		}
+		logger.Error("invalid pid limiting options", "name", option.Name, "err", err)
+	}
+	return newPidLimiting(option)
+}
+
+// New builds a PIDLimiting, it returns the error of config.Options.Validate instead of a limiter running on invalid options
+func New(kp float64, ki float64, kd float64, setPoint float64, opts ...config.OptionFunc) (*PIDLimiting, error) {
+	option := pidOptions(kp, ki, kd, setPoint, opts...)
+	if err := option.Validate(); err != nil {
+		return nil, err
+	}
+	return newPidLimiting(option), nil
+}
+
+// pidOptions applies the arguments and opts to the defaults overridden by the environment, the code takes precedence
+// so a process-wide variable does not override what a route sets explicitly
+func pidOptions(kp float64, ki float64, kd float64, setPoint float64, opts ...config.OptionFunc) *config.Options {
 	option := config.NewOptions()
+	option.Kp, option.Ki, option.Kd, option.Threshold = kp, ki, kd, setPoint
 	for _, opt := range opts {
 		opt(option)
 	}
-	var monitor cpu.Monitor
-	var upperBound, lowerBound func() float64
-	if option.DynamicPoint != nil {
-		upperBound = func() float64 {
-			return math.Min(0.99, option.DynamicPoint()+option.Drift)
+	return option
+}
+
+func newPidLimiting(option *config.Options) *PIDLimiting {
+	limit := &PIDLimiting{
+		rate:       0,
+		dryRun:     option.DryRun,
+		disabled:   option.Disabled,
+		logger:     option.Logger,
+		handlers:   option.EventHandlers,
+		ratioStep:  option.RatioEventStep,
+		dumpDir:    option.RecorderDumpDir,
+		dumpFormat: Format(option.RecorderDumpFormat),
+	}
+	limit.guard.report = limit.reportSetPoint
+	limit.options.Store(option)
+	limit.pid = pid.SetTunings(option.Kp, option.Ki, option.Kd, option.Threshold, pid.WithDynamicPoint(limit.setPoint))
+	limit.monitor = newSwapMonitor(newMonitor(limit.currentOptions, limit.setPoint, false))
+	if option.RecorderSize > 0 {
+		limit.recorder = NewRecorder(option.RecorderSize)
+	}
+	limit.name = register("pid", option.Name, limit)
+	limit.start()
+	limit.enablePid.Store(true)
+	return limit
+}
+
+// NewBBRLimiting rejects requests only when the cpu is overloaded and the in-flight requests exceed maxPass * minRT,
+// cpuThreshold and opts take precedence over the environment
+func NewBBRLimiting(cpuThreshold float64, opts ...config.OptionFunc) *BBRLimiting {
+	option := config.NewOptions()
+	option.Threshold = cpuThreshold
+	for _, opt := range opts {
+		opt(option)
+	}
+	if option.BBRBuckets < 2 {
+		logging.Warn("invalid bbr buckets, clamped to 2", "name", option.Name, "buckets", option.BBRBuckets)
+		option.BBRBuckets = 2
+	}
+	bucketDuration := option.BBRWindow / time.Duration(option.BBRBuckets)
+	guard := &setPointGuard{report: func(point float64, err error) {
+		logging.Warn("invalid bbr set point, clamped", "name", option.Name, "point", point, "err", err)
+		event.Publish(event.Event{Type: event.InvalidSetPoint, Source: "bbr", Time: time.Now(), Err: err})
+	}}
+	setPoint := func() float64 {
+		return guard.point(option)
+	}
+	limit := &BBRLimiting{
+		passStat:       stat.NewRollingWindow(option.BBRBuckets, bucketDuration),
+		rtStat:         stat.NewRollingWindow(option.BBRBuckets, bucketDuration),
+		bucketDuration: bucketDuration,
+		monitor:        newMonitor(func() *config.Options { return option }, setPoint, false),
+		now:            time.Now,
+	}
+	limit.name = register("bbr", option.Name, limit)
+	return limit
+}
+
+// newMonitor builds a cpu monitor whose bounds follow the set point and the drift of the current options
+func newMonitor(current func() *config.Options, setPoint func() float64, overload bool) cpu.Monitor {
+	upperBound := func() float64 {
+		return math.Min(0.99, setPoint()+current().Drift)
+	}
+	lowerBound := func() float64 {
+		return math.Max(0.01, setPoint()-current().Drift)
+	}
+	option := current()
+	opts := []cpu.Option{
+		cpu.WithUpperBound(upperBound), cpu.WithLowerBound(lowerBound),
+		cpu.WithAlg(option.MonitorAlg), cpu.WithInitialOverload(overload),
+	}
+	if option.Score > 0 {
+		opts = append(opts, cpu.WithThresholdScore(option.Score))
+	}
+	if option.Alpha > 0 {
+		opts = append(opts, cpu.WithAlpha(option.Alpha))
+	}
+	if option.Percentile > 0 {
+		opts = append(opts, cpu.WithPercentile(option.Percentile))
+	}
+	if option.ForecastModel != cpu.ForecastLinear || option.Horizon > 0 {
+		horizon := option.Horizon
+		if horizon == 0 {
+			horizon = cpu.DefaultHorizon
+		}
+		opts = append(opts, cpu.WithForecast(option.ForecastModel, horizon))
+	}
+	if option.Beta > 0 {
+		opts = append(opts, cpu.WithBeta(option.Beta))
+	}
+	return cpu.NewCPUMonitor(append(opts, hysteresis(option)...)...)
+}
+
+// hysteresis returns the monitor options for the confirmation settings that are set
+func hysteresis(option *config.Options) []cpu.Option {
+	var opts []cpu.Option
+	if option.EnterTimes > 0 || option.ExitTimes > 0 {
+		enter, exit := option.EnterTimes, option.ExitTimes
+		if enter == 0 {
+			enter = cpu.DefaultContinuousTimes
 		}
-		lowerBound = func() float64 {
-			return math.Max(0.01, option.DynamicPoint()-option.Drift)
+		if exit == 0 {
+			exit = cpu.DefaultContinuousTimes
 		}
-	} else {
-		upper := math.Min(0.99, setPoint+option.Drift)
-		upperBound = func() float64 {
-			return upper
+		opts = append(opts, cpu.WithContinuousTimes(enter, exit))
+	}
+	if option.EmergencyThreshold > 0 {
+		opts = append(opts, cpu.WithEmergencyThreshold(option.EmergencyThreshold))
+	}
+	if option.EnterWait > 0 || option.ExitWait > 0 {
+		enter, exit := option.EnterWait, option.ExitWait
+		if enter == 0 {
+			enter = cpu.DefaultWait
 		}
-		lower := math.Max(0.01, setPoint-option.Drift)
-		lowerBound = func() float64 {
-			return lower
+		if exit == 0 {
+			exit = cpu.DefaultWait
 		}
+		opts = append(opts, cpu.WithWait(enter, exit))
 	}
-	monitor = cpu.NewCPUMonitor(cpu.WithUpperBound(upperBound), cpu.WithLowerBound(lowerBound), cpu.WithAlg(option.MonitorAlg))
-	limit := &PIDLimiting{
-		rate:                0,
-		pid:                 pid.SetTunings(kp, ki, kd, setPoint, pid.WithDynamicPoint(option.DynamicPoint)),
-		monitor:             monitor,
-		enableMetric:        option.EnableMetric,
-		enableOverloadScene: option.EnableOverloadScene,
+	if option.MonitorInterval > 0 {
+		opts = append(opts, cpu.WithInterval(option.MonitorInterval))
+	}
+	if option.MonitorWindowSize > 0 {
+		opts = append(opts, cpu.WithWindow(option.MonitorWindow, option.MonitorWindowSize))
+	}
+	return opts
+}
+
+// monitorChanged reports whether next needs a new monitor, the bounds follow the options without one
+func monitorChanged(prev, next *config.Options) bool {
+	return next.MonitorAlg != prev.MonitorAlg || next.Score != prev.Score ||
+		next.Alpha != prev.Alpha || next.Percentile != prev.Percentile || next.ForecastModel != prev.ForecastModel ||
+		next.Horizon != prev.Horizon || next.Beta != prev.Beta ||
+		next.EnterTimes != prev.EnterTimes || next.ExitTimes != prev.ExitTimes ||
+		next.EmergencyThreshold != prev.EmergencyThreshold || next.EnterWait != prev.EnterWait ||
+		next.ExitWait != prev.ExitWait || next.MonitorInterval != prev.MonitorInterval ||
+		next.MonitorWindow != prev.MonitorWindow || next.MonitorWindowSize != prev.MonitorWindowSize
+}
+
+func setPointOf(option *config.Options) float64 {
+	if option.DynamicPoint != nil {
+		return option.DynamicPoint()
+	}
+	return option.Threshold
+}
+
+// setPointGuard keeps the set point in 0.01 ~ 1 when the threshold or the dynamic point goes wrong at runtime,
+// NaN and infinities fall back to the threshold. report is called once each time the set point turns invalid
+type setPointGuard struct {
+	invalid int32
+	report  func(point float64, err error)
+}
+
+func (g *setPointGuard) point(option *config.Options) float64 {
+	point := setPointOf(option)
+	if point > 0 && point <= 1 {
+		atomic.StoreInt32(&g.invalid, 0)
+		return point
+	}
+	if atomic.CompareAndSwapInt32(&g.invalid, 0, 1) && g.report != nil {
+		g.report(point, fmt.Errorf("limiting: set point should be in (0, 1], got %v", point))
+	}
+	return clampSetPoint(point, option.Threshold)
+}
+
+func clampSetPoint(point float64, threshold float64) float64 {
+	if math.IsNaN(point) || math.IsInf(point, 0) {
+		point = threshold
+		if math.IsNaN(point) || math.IsInf(point, 0) {
+			point = config.NewOptions().Threshold
+		}
+	}
+	return math.Min(1, math.Max(0.01, point))
+}
+
+// swapMonitor lets PIDLimiting.Update replace the monitor of a running limiter
+type swapMonitor struct {
+	v atomic.Value // monitorBox
+}
+
+type monitorBox struct {
+	cpu.Monitor
+}
+
+func newSwapMonitor(m cpu.Monitor) *swapMonitor {
+	s := &swapMonitor{}
+	s.v.Store(monitorBox{m})
+	return s
+}
+
+func (s *swapMonitor) load() cpu.Monitor {
+	return s.v.Load().(monitorBox).Monitor
+}
+
+func (s *swapMonitor) IsOverload() bool {
+	return s.load().IsOverload()
+}
+
+func (s *swapMonitor) State() cpu.MonitorState {
+	m := s.load()
+	if sm, ok := m.(cpu.StateMonitor); ok {
+		return sm.State()
+	}
+	return cpu.MonitorState{Overload: m.IsOverload()}
+}
+
+// swap replaces the monitor and stops the previous one
+func (s *swapMonitor) swap(m cpu.Monitor) {
+	prev := s.load()
+	s.v.Store(monitorBox{m})
+	if stoppable, ok := prev.(cpu.StoppableMonitor); ok {
+		stoppable.Stop()
 	}
-	limit.start()
-	limit.enablePid.Store(true)
-	return limit
 }
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package limiting
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/pid_limits/core/stat"
+	"github.com/bytedance/pid_limits/metrics/system/cpu"
+	"github.com/bytedance/pid_limits/util"
+)
+
+const (
+	// keep shedding for a while after the last drop, the cpu usage lags behind the in-flight requests
+	bbrCoolOff = time.Second
+)
+
+// BBRLimiting during cpu overload only rejects the requests exceeding the estimated capacity maxPass * minRT,
+// so the admitted requests always get a good latency
+type BBRLimiting struct {
+	name           string
+	passStat       *stat.RollingWindow
+	rtStat         *stat.RollingWindow
+	bucketDuration time.Duration
+	monitor        cpu.Monitor
+	inflight       int64
+	prevDrop       int64 // unix nano of the last drop
+	now            func() time.Time
+	requests       uint64
+	accepted       uint64
+	rejected       uint64
+}
+
+// Limit decides on the requests in flight without counting this one, it never completes. The limiter only measures
+// the requests going through Acquire and Complete, eg. in PlatoMiddlewareGinWithLimit, with Limit alone it follows
+// the ratio imposed by the control registry and never sheds by itself
+func (l *BBRLimiting) Limit() bool {
+	atomic.AddUint64(&l.requests, 1)
+	if l.drop() {
+		atomic.AddUint64(&l.rejected, 1)
+		return true
+	}
+	atomic.AddUint64(&l.accepted, 1)
+	return false
+}
+
+// Acquire is Limit counting an admitted request in flight until its Complete
+func (l *BBRLimiting) Acquire() bool {
+	if l.Limit() {
+		return true
+	}
+	atomic.AddInt64(&l.inflight, 1)
+	return false
+}
+
+// Overloaded reports whether the cpu monitor of the limiter considers the cpu overloaded
+func (l *BBRLimiting) Overloaded() bool {
+	return l.monitor.IsOverload()
+}
+
+func (l *BBRLimiting) Stats() Stats {
+	return Stats{
+		Ratio:    l.LimitRatio(),
+		Requests: atomic.LoadUint64(&l.requests),
+		Accepted: atomic.LoadUint64(&l.accepted),
+		Rejected: atomic.LoadUint64(&l.rejected),
+	}
+}
+
+// Complete records the pass count and rt of a request admitted by Acquire
+func (l *BBRLimiting) Complete(rt time.Duration) {
+	atomic.AddInt64(&l.inflight, -1)
+	l.passStat.Add(1)
+	l.rtStat.Add(rt.Milliseconds())
+}
+
+// LimitRatio the probability is form 0 ~ 10000, it is the share of in-flight requests above the capacity
+func (l *BBRLimiting) LimitRatio() float64 {
+	if ratio, ok := override(l.name); ok {
+		return ratio
+	}
+	if !l.monitor.IsOverload() {
+		return 0
+	}
+	inflight := float64(atomic.LoadInt64(&l.inflight))
+	if inflight <= 0 {
+		return 0
+	}
+	return math.Min(10000, math.Max(0, (1-float64(l.maxInflight())/inflight)*10000))
+}
+
+// drop follows the ratio imposed by the control registry, if any, instead of the in-flight requests
+func (l *BBRLimiting) drop() bool {
+	if ratio, ok := override(l.name); ok {
+		return float64(util.Uint32n(10000)) < ratio
+	}
+	return l.shouldDrop()
+}
+
+func (l *BBRLimiting) shouldDrop() bool {
+	now := l.now().UnixNano()
+	if !l.monitor.IsOverload() {
+		prevDrop := atomic.LoadInt64(&l.prevDrop)
+		if prevDrop == 0 || time.Duration(now-prevDrop) > bbrCoolOff {
+			return false
+		}
+	}
+	inflight := atomic.LoadInt64(&l.inflight)
+	if inflight > 1 && inflight > l.maxInflight() {
+		atomic.StoreInt64(&l.prevDrop, now)
+		return true
+	}
+	return false
+}
+
+// maxInflight is maxPass per bucket * minRT / bucket duration, ie. the concurrency the instance can serve
+func (l *BBRLimiting) maxInflight() int64 {
+	bucketMs := float64(l.bucketDuration.Milliseconds())
+	if bucketMs <= 0 {
+		bucketMs = 1
+	}
+	return int64(math.Floor(float64(l.maxPass())*float64(l.minRT())/bucketMs + 0.5))
+}
+
+func (l *BBRLimiting) maxPass() int64 {
+	var max int64 = 1
+	l.passStat.Reduce(func(b stat.Bucket) {
+		if b.Sum > max {
+			max = b.Sum
+		}
+	})
+	return max
+}
+
+func (l *BBRLimiting) minRT() int64 {
+	var min = math.MaxFloat64
+	l.rtStat.Reduce(func(b stat.Bucket) {
+		if b.Count == 0 {
+			return
+		}
+		if avg := float64(b.Sum) / float64(b.Count); avg < min {
+			min = avg
+		}
+	})
+	if min == math.MaxFloat64 {
+		return 1
+	}
+	return int64(math.Max(1, math.Ceil(min)))
+}
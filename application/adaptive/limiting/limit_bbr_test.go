@@ -0,0 +1,112 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package limiting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/config"
+	"github.com/bytedance/pid_limits/core/stat"
+	"github.com/bytedance/pid_limits/metrics/system/cpu"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeMonitor struct {
+	overload bool
+}
+
+func (m *fakeMonitor) IsOverload() bool {
+	return m.overload
+}
+
+func TestBBRLimiting(t *testing.T) {
+	now := time.UnixMilli(1000000)
+	clock := func() time.Time { return now }
+	monitor := &fakeMonitor{}
+	l := &BBRLimiting{
+		passStat:       stat.NewRollingWindowWithClock(10, 100*time.Millisecond, clock),
+		rtStat:         stat.NewRollingWindowWithClock(10, 100*time.Millisecond, clock),
+		bucketDuration: 100 * time.Millisecond,
+		monitor:        monitor,
+		now:            clock,
+	}
+
+	// 100 requests with 20ms rt in one bucket, the capacity is 100 * 20 / 100 = 20
+	for i := 0; i < 100; i++ {
+		assert.False(t, l.Acquire())
+		l.Complete(20 * time.Millisecond)
+	}
+	now = now.Add(100 * time.Millisecond)
+	assert.Equal(t, int64(20), l.maxInflight())
+
+	// not overloaded, nothing is rejected
+	for i := 0; i < 30; i++ {
+		assert.False(t, l.Acquire())
+	}
+	assert.Equal(t, float64(0), l.LimitRatio())
+
+	monitor.overload = true
+	assert.True(t, l.Acquire())
+	assert.InDelta(t, 10000.0/3, l.LimitRatio(), 1)
+	for i := 0; i < 10; i++ {
+		l.Complete(20 * time.Millisecond)
+	}
+	assert.False(t, l.Acquire())
+
+	// keep dropping during the cool off even if the monitor already recovered
+	monitor.overload = false
+	assert.True(t, l.Acquire())
+	now = now.Add(2 * time.Second)
+	assert.False(t, l.Acquire())
+
+	// Limit alone never counts a request in flight
+	monitor.overload = true
+	inflight := l.inflight
+	for i := 0; i < 100; i++ {
+		l.Limit()
+	}
+	assert.Equal(t, inflight, l.inflight)
+}
+
+func TestNewBBRLimitingBuckets(t *testing.T) {
+	option := config.NewOptions()
+	config.WithBBRWindow(time.Second, 1)(option)
+	assert.Error(t, option.Validate())
+	config.WithBBRWindow(time.Second, 2)(option)
+	assert.NoError(t, option.Validate())
+
+	l := NewBBRLimiting(0.8, config.WithName("bbr-buckets-test"), config.WithBBRWindow(time.Second, 1))
+	defer Unregister("bbr-buckets-test")
+	defer l.monitor.(cpu.StoppableMonitor).Stop()
+	assert.Equal(t, 500*time.Millisecond, l.bucketDuration)
+}
+
+func TestNewBBRLimitingEnv(t *testing.T) {
+	t.Setenv(config.EnvThreshold, "0.6")
+	t.Setenv(config.EnvDrift, "0.05")
+	l := NewBBRLimiting(0.8, config.WithName("bbr-env-test"))
+	defer Unregister("bbr-env-test")
+	defer l.monitor.(cpu.StoppableMonitor).Stop()
+
+	// the threshold argument takes precedence over the environment, the drift left unset in code follows it
+	assert.InDelta(t, 0.85, l.monitor.(cpu.StateMonitor).State().UpperThreshold, 1e-9)
+
+	l = NewBBRLimiting(0.8, config.WithName("bbr-env-test-drift"), config.WithDrift(0.15))
+	defer Unregister("bbr-env-test-drift")
+	defer l.monitor.(cpu.StoppableMonitor).Stop()
+	assert.InDelta(t, 0.95, l.monitor.(cpu.StateMonitor).State().UpperThreshold, 1e-9)
+}
@@ -16,53 +16,369 @@
 package limiting
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"math"
+	"os"
+	"path/filepath"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/bytedance/pid_limits/application/adaptive/config"
 	"github.com/bytedance/pid_limits/arithmetic/pid"
+	"github.com/bytedance/pid_limits/core/event"
 	"github.com/bytedance/pid_limits/metrics/system/cpu"
 	"github.com/bytedance/pid_limits/util"
+	"github.com/bytedance/pid_limits/util/logging"
 )
 
+const pidEventSource = "pid"
+
 type PIDLimiting struct {
-	rate                uint32
-	pid                 *pid.PID
-	monitor             cpu.Monitor
-	enableMetric        bool
-	enableOverloadScene bool
-	enablePid           atomic.Value
+	name           string
+	rate           uint32
+	pid            *pid.PID
+	monitor        cpu.Monitor
+	enablePid      atomic.Value
+	options        atomic.Value // *config.Options, replaced by Update
+	guard          setPointGuard
+	updateLock     sync.Mutex
+	dryRun         bool
+	disabled       bool
+	requests       uint64
+	accepted       uint64
+	rejected       uint64
+	shadowRejected uint64
+	logger         logging.Logger
+	handlers       []event.Handler
+	ratioStep      float64
+	recorder       *Recorder
+	dumpDir        string
+	dumpFormat     Format
+	ramp           atomic.Value // recovery
+	// overloaded and lastRatio are the state of the last published events, shedRatio is the reject ratio of the
+	// last overloaded tick, they are only touched by the loop
+	overloaded bool
+	lastRatio  float64
+	shedRatio  float64
+}
+
+// Stats are the counters of a PIDLimiting since it was created
+type Stats struct {
+	DryRun bool
+	// Disabled limiters admit every request, their ratios are 0
+	Disabled bool
+	// Ratio is the reject ratio applied to requests, 0 ~ 10000, always 0 in dry-run mode
+	Ratio float64
+	// ShadowRatio is the reject ratio that would be applied in dry-run mode
+	ShadowRatio float64
+	Requests    uint64
+	// Accepted is counted on its own, Requests - Rejected can go down between two snapshots
+	Accepted       uint64
+	Rejected       uint64
+	ShadowRejected uint64
 }
 
 func (l *PIDLimiting) Limit() bool {
-	if l.monitor.IsOverload() && util.Uint32n(10000) < atomic.LoadUint32(&l.rate) {
-		return true
+	reject, _ := l.LimitShadow()
+	return reject
+}
+
+// LimitShadow returns whether the request is rejected, and in dry-run mode whether it would have been rejected
+func (l *PIDLimiting) LimitShadow() (reject bool, wouldReject bool) {
+	return l.shadow(float64(util.Uint32n(10000)) < l.ratio())
+}
+
+// LimitWithPriority spreads the reject ratio across the priority tiers, lowest first
+func (l *PIDLimiting) LimitWithPriority(p Priority) bool {
+	reject, _ := l.LimitWithPriorityShadow(p)
+	return reject
+}
+
+// LimitWithPriorityShadow is LimitShadow for a request with a priority tier
+func (l *PIDLimiting) LimitWithPriorityShadow(p Priority) (reject bool, wouldReject bool) {
+	return l.shadow(float64(util.Uint32n(10000)) < priorityRatio(l.ratio(), p))
+}
+
+func (l *PIDLimiting) shadow(reject bool) (bool, bool) {
+	atomic.AddUint64(&l.requests, 1)
+	if !reject {
+		atomic.AddUint64(&l.accepted, 1)
+		return false, false
+	}
+	if l.dryRun {
+		atomic.AddUint64(&l.accepted, 1)
+		atomic.AddUint64(&l.shadowRejected, 1)
+		return false, true
 	}
-	return false
+	atomic.AddUint64(&l.rejected, 1)
+	return true, false
 }
 
 // Rate the probability is form 0 ~ 10000
 func (l *PIDLimiting) LimitRatio() float64 {
+	if l.dryRun {
+		return 0
+	}
+	return l.ratio()
+}
+
+// ratio is the reject ratio of the pid during an overload and of the recovery ramp after it, unless the limiter is
+// disabled or overridden by the control registry
+func (l *PIDLimiting) ratio() float64 {
+	if l.disabled {
+		return 0
+	}
+	if ratio, ok := override(l.name); ok {
+		return ratio
+	}
 	if l.monitor.IsOverload() {
 		return math.Min(10000, math.Max(0, float64(atomic.LoadUint32(&l.rate))))
 	}
-	return 0
+	return l.recoveryRatio()
+}
+
+func (l *PIDLimiting) Stats() Stats {
+	stats := Stats{
+		DryRun:         l.dryRun,
+		Disabled:       l.disabled,
+		Ratio:          l.LimitRatio(),
+		Requests:       atomic.LoadUint64(&l.requests),
+		Accepted:       atomic.LoadUint64(&l.accepted),
+		Rejected:       atomic.LoadUint64(&l.rejected),
+		ShadowRejected: atomic.LoadUint64(&l.shadowRejected),
+	}
+	if l.dryRun {
+		stats.ShadowRatio = l.ratio()
+	}
+	return stats
+}
+
+// Snapshot is the live state of a PIDLimiting, for debugging
+type Snapshot struct {
+	Name  string
+	Stats Stats
+	// Kp, Ki and Kd are the pid gains, SetPoint, ErrSum and Output come from the last computation
+	Kp, Ki, Kd float64
+	SetPoint   float64
+	ErrSum     float64
+	Output     float64
+	Overloaded bool
+	// Monitor is the state of the cpu monitor, its thresholds are the set point plus and minus the drift.
+	// it is nil for monitors not implementing cpu.StateMonitor
+	Monitor *cpu.MonitorState
+}
+
+func (l *PIDLimiting) Snapshot() Snapshot {
+	state := l.pid.State()
+	snapshot := Snapshot{
+		Name:     l.name,
+		Stats:    l.Stats(),
+		SetPoint: l.pid.GetThreshold(),
+		ErrSum:   state.Integral,
+		Output:   state.Output,
+	}
+	snapshot.Kp, snapshot.Ki, snapshot.Kd = l.pid.Tunings()
+	if m, ok := l.monitor.(cpu.StateMonitor); ok {
+		monitor := m.State()
+		snapshot.Monitor = &monitor
+		snapshot.Overloaded = monitor.Overload
+	} else {
+		snapshot.Overloaded = l.monitor.IsOverload()
+	}
+	return snapshot
+}
+
+func (l *PIDLimiting) currentOptions() *config.Options {
+	option, _ := l.options.Load().(*config.Options)
+	return option
+}
+
+func (l *PIDLimiting) setPoint() float64 {
+	return l.guard.point(l.currentOptions())
+}
+
+func (l *PIDLimiting) reportSetPoint(point float64, err error) {
+	l.log().Warn("invalid set point, clamped", "name", l.name, "point", point, "err", err)
+	l.publish(event.Event{Type: event.InvalidSetPoint, Err: err})
+}
+
+// Update validates and applies new options to the running limiter, the pid state and the overload status are kept.
+// The gains, threshold, dynamic point, drift, monitor settings, recovery and metric flags can be updated, new monitor
+// settings other than the bounds replace the monitor. Name, DryRun, Disabled, RatioEventStep and the recorder
+// options are fixed at construction and changing them is an error, the logger, event handlers and the options of
+// other limiters are ignored
+func (l *PIDLimiting) Update(opts ...config.OptionFunc) error {
+	l.updateLock.Lock()
+	defer l.updateLock.Unlock()
+	prev := l.currentOptions()
+	next, err := l.nextOptions(prev, opts)
+	if err != nil {
+		return err
+	}
+	l.options.Store(next)
+	l.pid.SetGains(next.Kp, next.Ki, next.Kd)
+	if monitorChanged(prev, next) {
+		monitor := l.monitor.(*swapMonitor)
+		monitor.swap(newMonitor(l.currentOptions, l.setPoint, monitor.IsOverload()))
+	}
+	l.log().Info("limiter updated", "name", l.name, "kp", next.Kp, "ki", next.Ki, "kd", next.Kd,
+		"threshold", next.Threshold, "drift", next.Drift, "alg", next.MonitorAlg, "score", next.Score)
+	return nil
+}
+
+// CheckUpdate returns the error Update would return for opts without applying them, so a set of limiters
+// can be validated before any of them is updated
+func (l *PIDLimiting) CheckUpdate(opts ...config.OptionFunc) error {
+	l.updateLock.Lock()
+	defer l.updateLock.Unlock()
+	_, err := l.nextOptions(l.currentOptions(), opts)
+	return err
+}
+
+// nextOptions applies opts to a copy of prev and validates the result, the caller holds updateLock
+func (l *PIDLimiting) nextOptions(prev *config.Options, opts []config.OptionFunc) (*config.Options, error) {
+	if _, ok := l.monitor.(*swapMonitor); prev == nil || !ok {
+		return nil, errors.New("limiting: only a limiter built by NewPidLimiting can be updated")
+	}
+	next := *prev
+	next.EventHandlers = append([]event.Handler(nil), prev.EventHandlers...)
+	for _, opt := range opts {
+		opt(&next)
+	}
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+	if next.Name != prev.Name || next.DryRun != prev.DryRun || next.Disabled != prev.Disabled ||
+		next.RatioEventStep != prev.RatioEventStep ||
+		next.RecorderSize != prev.RecorderSize || next.RecorderDumpDir != prev.RecorderDumpDir ||
+		next.RecorderDumpFormat != prev.RecorderDumpFormat {
+		return nil, errors.New("limiting: Name, DryRun, Disabled, RatioEventStep and the recorder options can not be updated")
+	}
+	return &next, nil
+}
+
+// Recorder is the flight recorder of the control loop, nil when disabled by config.WithRecorder(0)
+func (l *PIDLimiting) Recorder() *Recorder {
+	return l.recorder
+}
+
+// autoDump writes the recorder to a new file in the dump dir, off the control loop
+func (l *PIDLimiting) autoDump() {
+	if l.recorder == nil || l.dumpDir == "" {
+		return
+	}
+	ticks := l.recorder.Ticks()
+	name := l.name
+	if name == "" {
+		name = pidEventSource
+	}
+	path := filepath.Join(l.dumpDir, name+"-"+time.Now().Format(recorderTimeFile)+"."+string(l.dumpFormat))
+	go func() {
+		if err := dumpFile(path, l.dumpFormat, ticks); err != nil {
+			l.log().Error("dump flight recorder failed", "path", path, "err", err)
+			return
+		}
+		l.log().Info("flight recorder dumped", "path", path, "ticks", len(ticks))
+	}()
+}
+
+func dumpFile(path string, format Format, ticks []Tick) error {
+	if format != FormatCSV && format != FormatJSONLines {
+		return fmt.Errorf("unknown recorder format %q", format)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := dumpTicks(f, format, ticks); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Name is the name the limiter is registered under
+func (l *PIDLimiting) Name() string {
+	return l.name
+}
+
+// Overloaded reports whether the cpu monitor of the limiter considers the cpu overloaded
+func (l *PIDLimiting) Overloaded() bool {
+	return l.monitor.IsOverload()
+}
+
+// PIDState is the state of the last pid computation, the output is the negated reject rate
+func (l *PIDLimiting) PIDState() pid.State {
+	return l.pid.State()
 }
 
 func (l *PIDLimiting) start() {
 	go util.LoopWithInterval(func() {
 		cpuUsage := cpu.GetUsage()
-		if !l.enableOverloadScene {
+		option := l.currentOptions()
+		if !option.EnableOverloadScene {
 			cpuUsage = math.Min(cpuUsage, 1)
 		}
 		rate := l.pid.Compute(cpuUsage)
 		atomic.StoreUint32(&l.rate, uint32(-rate))
-		if l.enableMetric {
-			log.Printf(
-				"cpu usage is: %f, threshould is: %f, reject rate is %f, overloaded: %v",
-				cpuUsage, l.pid.GetThreshold(), -rate, l.monitor.IsOverload(),
-			)
+		overloaded := l.monitor.IsOverload()
+		now := time.Now()
+		l.rampTick(cpuUsage, overloaded, option, now)
+		if l.recorder != nil {
+			state := l.pid.State()
+			l.recorder.Record(Tick{
+				Time: now, CPUUsage: cpuUsage, SetPoint: state.SetPoint,
+				P: state.P, I: state.I, D: state.D, Output: state.Output, Overload: overloaded,
+			})
 		}
+		if option.EnableMetric {
+			l.log().Debug("pid limiting",
+				"cpu", cpuUsage, "threshold", l.pid.GetThreshold(), "rate", -rate, "overloaded", overloaded)
+		}
+		l.observe(cpuUsage, overloaded)
 	}, 100*time.Millisecond)
 }
+
+func (l *PIDLimiting) log() logging.Logger {
+	if l.logger != nil {
+		return l.logger
+	}
+	return logging.Default()
+}
+
+// observe publishes the overload transitions and the reject ratio moves since the last events
+func (l *PIDLimiting) observe(cpuUsage float64, overloaded bool) {
+	ratio := 0.0
+	if overloaded {
+		ratio = math.Min(10000, math.Max(0, float64(atomic.LoadUint32(&l.rate))))
+	}
+	if overloaded != l.overloaded {
+		l.overloaded = overloaded
+		if overloaded {
+			l.log().Warn("overload started", "cpu", cpuUsage, "ratio", ratio, "dry_run", l.dryRun)
+			l.publish(event.Event{Type: event.OverloadStarted, CPUUsage: cpuUsage, Ratio: ratio, PrevRatio: l.lastRatio})
+		} else {
+			l.log().Info("overload ended", "cpu", cpuUsage)
+			l.publish(event.Event{Type: event.OverloadEnded, CPUUsage: cpuUsage, Ratio: ratio, PrevRatio: l.lastRatio})
+			l.autoDump()
+		}
+	}
+	if l.ratioStep > 0 && math.Abs(ratio-l.lastRatio) >= l.ratioStep {
+		l.publish(event.Event{Type: event.RatioChanged, CPUUsage: cpuUsage, Ratio: ratio, PrevRatio: l.lastRatio})
+		l.lastRatio = ratio
+	}
+}
+
+func (l *PIDLimiting) publish(e event.Event) {
+	e.Source = pidEventSource
+	if l.name != "" {
+		e.Source = l.name
+	}
+	e.Time = time.Now()
+	for _, h := range l.handlers {
+		h(e)
+	}
+	event.Publish(e)
+}
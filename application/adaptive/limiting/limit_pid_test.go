@@ -0,0 +1,172 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package limiting
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/config"
+	"github.com/bytedance/pid_limits/arithmetic/pid"
+	"github.com/bytedance/pid_limits/core/event"
+	"github.com/bytedance/pid_limits/metrics/system/cpu"
+	"github.com/bytedance/pid_limits/util/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPIDLimitingObserve(t *testing.T) {
+	var got []event.Event
+	l := &PIDLimiting{
+		rate:      3000,
+		monitor:   &fakeMonitor{overload: true},
+		logger:    logging.Nop(),
+		ratioStep: 1000,
+		handlers:  []event.Handler{func(e event.Event) { got = append(got, e) }},
+	}
+	l.observe(0.9, true)
+	l.rate = 3500
+	l.observe(0.9, true)
+	l.rate = 4000
+	l.observe(0.9, true)
+	l.observe(0.5, false)
+
+	types := make([]event.Type, 0, len(got))
+	for _, e := range got {
+		assert.Equal(t, pidEventSource, e.Source)
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []event.Type{event.OverloadStarted, event.RatioChanged, event.RatioChanged, event.OverloadEnded, event.RatioChanged}, types)
+	assert.Equal(t, float64(3000), got[1].Ratio)
+	assert.Equal(t, float64(4000), got[2].Ratio)
+	assert.Equal(t, float64(3000), got[2].PrevRatio)
+	assert.Equal(t, float64(0), got[4].Ratio)
+}
+
+func TestPIDLimitingSnapshot(t *testing.T) {
+	l := &PIDLimiting{name: "snapshot", rate: 2000, pid: pid.SetTunings(1, 2, 3, 0.7), monitor: &fakeMonitor{overload: true}}
+	l.pid.Compute(0.9)
+	s := l.Snapshot()
+	assert.Equal(t, "snapshot", s.Name)
+	assert.Equal(t, []float64{1, 2, 3, 0.7}, []float64{s.Kp, s.Ki, s.Kd, s.SetPoint})
+	assert.Equal(t, l.pid.State().Output, s.Output)
+	assert.True(t, s.Overloaded)
+	assert.Nil(t, s.Monitor)
+	assert.Equal(t, float64(2000), s.Stats.Ratio)
+}
+
+func TestPIDLimitingUpdate(t *testing.T) {
+	l := NewPidLimiting(1, 2, 3, 0.8, config.WithName("update-test"), config.WithDisableMetric(), config.WithRecorder(0))
+	defer Unregister("update-test")
+
+	assert.NoError(t, l.Update(config.WithGains(4, 5, 6), config.WithThreshold(0.7), config.WithDrift(0.05)))
+	s := l.Snapshot()
+	assert.Equal(t, []float64{4, 5, 6, 0.7}, []float64{s.Kp, s.Ki, s.Kd, s.SetPoint})
+	assert.InDelta(t, 0.75, s.Monitor.UpperThreshold, 1e-9)
+	assert.InDelta(t, 0.65, s.Monitor.LowerThreshold, 1e-9)
+
+	assert.Error(t, l.Update(config.WithThreshold(2)))
+	assert.Error(t, l.Update(config.WithName("renamed")))
+	assert.Error(t, l.Update(config.WithDryRun()))
+	assert.Equal(t, 0.7, l.Snapshot().SetPoint)
+
+	// a new algorithm replaces the monitor and keeps the overload status
+	l.monitor.(*swapMonitor).swap(&fakeMonitor{overload: true})
+	assert.NoError(t, l.Update(config.WithMonitorAlg(cpu.Raw)))
+	s = l.Snapshot()
+	assert.Equal(t, cpu.Raw, s.Monitor.Alg)
+	assert.True(t, s.Overloaded)
+	assert.Equal(t, "update-test", s.Name)
+
+	literal := &PIDLimiting{monitor: &fakeMonitor{}}
+	assert.Error(t, literal.Update())
+}
+
+func TestNewInvalid(t *testing.T) {
+	l, err := New(-1, 0, 0, 0.8, config.WithDisableMetric())
+	assert.Error(t, err)
+	assert.Nil(t, l)
+	_, err = New(1, 0, 0, 0.8, config.WithDrift(1), config.WithDisableMetric())
+	assert.Error(t, err)
+
+	l, err = New(1, 2, 3, 0.8, config.WithName("new-test"), config.WithDisableMetric())
+	defer Unregister("new-test")
+	assert.NoError(t, err)
+	assert.Equal(t, "new-test", l.Name())
+}
+
+func TestSetPointGuard(t *testing.T) {
+	var got []event.Event
+	point := 0.7
+	l := &PIDLimiting{
+		logger:   logging.Nop(),
+		handlers: []event.Handler{func(e event.Event) { got = append(got, e) }},
+	}
+	l.guard.report = l.reportSetPoint
+	l.options.Store(pidOptions(1, 2, 3, 0.8, config.WithDynamicPoint(func() float64 { return point })))
+	assert.Equal(t, 0.7, l.setPoint())
+
+	point = math.NaN()
+	assert.Equal(t, 0.8, l.setPoint())
+	assert.Equal(t, 0.8, l.setPoint())
+	point = 3
+	assert.Equal(t, 1.0, l.setPoint())
+	point = 0.6
+	assert.Equal(t, 0.6, l.setPoint())
+	point = -1
+	assert.Equal(t, 0.01, l.setPoint())
+
+	assert.Len(t, got, 2)
+	for _, e := range got {
+		assert.Equal(t, event.InvalidSetPoint, e.Type)
+		assert.Error(t, e.Err)
+	}
+}
+
+func TestNewEnv(t *testing.T) {
+	t.Setenv(config.EnvThreshold, "0.6")
+	t.Setenv(config.EnvDisable, "true")
+	// the environment overrides the defaults, the code overrides the environment
+	assert.Equal(t, 0.6, config.NewOptions().Threshold)
+	assert.Equal(t, 0.9, pidOptions(1, 2, 3, 0.9).Threshold)
+	l, err := New(1, 2, 3, 0.9, config.WithThreshold(0.85), config.WithName("env-test"), config.WithDisableMetric())
+	defer Unregister("env-test")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.85, l.Snapshot().SetPoint)
+
+	// the limiter is running, a disabled one rejects nothing whatever its ratio
+	assert.False(t, l.Limit())
+	assert.Equal(t, float64(0), l.LimitRatio())
+	assert.True(t, l.Stats().Disabled)
+	assert.Error(t, l.Update(func(o *config.Options) { o.Disabled = false }))
+}
+
+func TestPIDLimitingUpdateHysteresis(t *testing.T) {
+	assert.Empty(t, hysteresis(config.NewOptions()))
+	l := NewPidLimiting(1, 2, 3, 0.8, config.WithName("hysteresis-test"), config.WithDisableMetric(), config.WithRecorder(0))
+	defer Unregister("hysteresis-test")
+	monitor := l.monitor.(*swapMonitor)
+	prev := monitor.load()
+
+	assert.NoError(t, l.Update(config.WithThreshold(0.75)))
+	assert.Equal(t, prev, monitor.load())
+	assert.NoError(t, l.Update(config.WithContinuousTimes(10, 50), config.WithMonitorWindow(10*time.Second, 100)))
+	assert.NotEqual(t, prev, monitor.load())
+	assert.Len(t, hysteresis(l.currentOptions()), 2)
+
+	assert.NoError(t, l.Update(config.WithMonitorAlg(cpu.EWMA), config.WithAlpha(0.5)))
+	assert.Equal(t, cpu.EWMA, l.Snapshot().Monitor.Alg)
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package limiting
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Priority is the criticality tier of a request, during an overload the lower tiers are shed first
+type Priority int
+
+const (
+	PriorityBackground Priority = iota
+	PriorityBatch
+	PriorityDefault
+	PriorityCritical
+
+	priorityCount = int(PriorityCritical) + 1
+)
+
+var priorityNames = map[string]Priority{
+	"background": PriorityBackground,
+	"batch":      PriorityBatch,
+	"default":    PriorityDefault,
+	"critical":   PriorityCritical,
+}
+
+func (p Priority) String() string {
+	for name, priority := range priorityNames {
+		if priority == p {
+			return name
+		}
+	}
+	return strconv.Itoa(int(p))
+}
+
+// ParsePriority accepts the tier name, eg. "batch", or its number
+func ParsePriority(s string) (Priority, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if p, ok := priorityNames[s]; ok {
+		return p, true
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < int(PriorityBackground) || n > int(PriorityCritical) {
+		return PriorityDefault, false
+	}
+	return Priority(n), true
+}
+
+// PriorityLimit is implemented by limiters that can shed by tiers
+type PriorityLimit interface {
+	RateLimit
+	LimitWithPriority(p Priority) bool
+}
+
+// priorityRatio spreads the overall reject ratio (0 ~ 10000) across the tiers, lowest first,
+// every tier takes an equal share of the ratio and a tier is only rejected once all lower tiers reach 100%
+func priorityRatio(ratio float64, p Priority) float64 {
+	if p < PriorityBackground {
+		p = PriorityBackground
+	}
+	if p > PriorityCritical {
+		p = PriorityCritical
+	}
+	share := ratio*float64(priorityCount) - float64(p)*10000
+	return math.Min(10000, math.Max(0, share))
+}
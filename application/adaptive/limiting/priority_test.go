@@ -0,0 +1,113 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package limiting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePriority(t *testing.T) {
+	p, ok := ParsePriority(" Batch ")
+	assert.True(t, ok)
+	assert.Equal(t, PriorityBatch, p)
+	p, ok = ParsePriority("3")
+	assert.True(t, ok)
+	assert.Equal(t, PriorityCritical, p)
+	_, ok = ParsePriority("9")
+	assert.False(t, ok)
+	assert.Equal(t, "critical", PriorityCritical.String())
+}
+
+func TestPriorityRatio(t *testing.T) {
+	// 30% overall: background is fully shed, batch takes the remaining 20% of its share
+	assert.Equal(t, float64(10000), priorityRatio(3000, PriorityBackground))
+	assert.InDelta(t, 2000, priorityRatio(3000, PriorityBatch), 1e-9)
+	assert.Equal(t, float64(0), priorityRatio(3000, PriorityDefault))
+	assert.Equal(t, float64(0), priorityRatio(3000, PriorityCritical))
+
+	assert.Equal(t, float64(10000), priorityRatio(10000, PriorityCritical))
+	assert.Equal(t, float64(0), priorityRatio(0, PriorityBackground))
+}
+
+func TestPIDLimitingLimitWithPriority(t *testing.T) {
+	l := &PIDLimiting{rate: 5000, monitor: &fakeMonitor{overload: true}}
+	for i := 0; i < 100; i++ {
+		assert.True(t, l.LimitWithPriority(PriorityBatch))
+		assert.False(t, l.LimitWithPriority(PriorityDefault))
+	}
+	l.monitor = &fakeMonitor{}
+	assert.False(t, l.LimitWithPriority(PriorityBackground))
+}
+
+func TestPIDLimitingDryRun(t *testing.T) {
+	l := &PIDLimiting{rate: 10000, monitor: &fakeMonitor{overload: true}, dryRun: true}
+	for i := 0; i < 10; i++ {
+		assert.False(t, l.Limit())
+		reject, wouldReject := l.LimitWithPriorityShadow(PriorityBackground)
+		assert.False(t, reject)
+		assert.True(t, wouldReject)
+	}
+	_, wouldReject := l.LimitWithPriorityShadow(PriorityCritical)
+	assert.True(t, wouldReject)
+	assert.Equal(t, float64(0), l.LimitRatio())
+	assert.Equal(t, Stats{DryRun: true, ShadowRatio: 10000, Requests: 21, Accepted: 21, ShadowRejected: 21}, l.Stats())
+
+	l = &PIDLimiting{rate: 10000, monitor: &fakeMonitor{overload: true}}
+	reject, wouldReject := l.LimitShadow()
+	assert.True(t, reject)
+	assert.False(t, wouldReject)
+	l.monitor = &fakeMonitor{}
+	assert.False(t, l.Limit())
+	assert.Equal(t, Stats{Requests: 2, Accepted: 1, Rejected: 1}, l.Stats())
+}
+
+func TestAdmissionPriority(t *testing.T) {
+	l := &PIDLimiting{rate: 5000, monitor: &fakeMonitor{overload: true}}
+	a := NewAdmission(l, false)
+	// a request without a tier is shed by the plain ratio, half of them at 5000
+	var rejected int
+	for i := 0; i < 10000; i++ {
+		if reject, _ := a.Limit(PriorityBackground, false, ""); reject {
+			rejected++
+		}
+	}
+	assert.InDelta(t, 5000, rejected, 300)
+	for i := 0; i < 100; i++ {
+		reject, _ := a.Limit(PriorityDefault, true, "")
+		assert.False(t, reject)
+		reject, _ = a.Limit(PriorityBatch, true, "")
+		assert.True(t, reject)
+	}
+
+	// a tenant keeps its fair share whatever the tier, the tiers split the ratio of the tenant
+	a = NewAdmission(l, true)
+	for i := 0; i < 100; i++ {
+		reject, _ := a.Limit(PriorityCritical, true, "a")
+		assert.False(t, reject)
+		reject, _ = a.Limit(PriorityBatch, true, "a")
+		assert.True(t, reject)
+	}
+	// a tenant without a tier is shed by the ratio of the tenant
+	rejected = 0
+	for i := 0; i < 10000; i++ {
+		if reject, _ := a.Limit(PriorityDefault, false, "a"); reject {
+			rejected++
+		}
+	}
+	assert.InDelta(t, 5000, rejected, 300)
+}
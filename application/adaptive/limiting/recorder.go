@@ -0,0 +1,131 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package limiting
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Format is the format of a Recorder dump
+type Format string
+
+const (
+	FormatCSV        Format = "csv"
+	FormatJSONLines  Format = "jsonl"
+	defaultRecorder         = 3000 // 5 minutes of 100ms ticks
+	recorderTimeFile        = "20060102-150405.000"
+)
+
+// Tick is a control loop iteration, P, I and D are the pid terms summed into the output
+type Tick struct {
+	Time     time.Time `json:"time"`
+	CPUUsage float64   `json:"cpu_usage"`
+	SetPoint float64   `json:"set_point"`
+	P        float64   `json:"p"`
+	I        float64   `json:"i"`
+	D        float64   `json:"d"`
+	Output   float64   `json:"output"`
+	Overload bool      `json:"overload"`
+}
+
+var csvHeader = []string{"time", "cpu_usage", "set_point", "p", "i", "d", "output", "overload"}
+
+// Recorder is a fixed-size ring buffer of the latest ticks
+type Recorder struct {
+	mu    sync.Mutex
+	ticks []Tick
+	next  int
+	full  bool
+}
+
+func NewRecorder(size int) *Recorder {
+	if size <= 0 {
+		size = 1
+	}
+	return &Recorder{ticks: make([]Tick, size)}
+}
+
+// Record stores t, overwriting the oldest tick when the buffer is full
+func (r *Recorder) Record(t Tick) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ticks[r.next] = t
+	r.next++
+	if r.next == len(r.ticks) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// Ticks returns a copy of the recorded ticks, oldest first
+func (r *Recorder) Ticks() []Tick {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]Tick(nil), r.ticks[:r.next]...)
+	}
+	ticks := make([]Tick, 0, len(r.ticks))
+	ticks = append(ticks, r.ticks[r.next:]...)
+	return append(ticks, r.ticks[:r.next]...)
+}
+
+// Dump writes the recorded ticks, oldest first, as csv with a header line or as json lines
+func (r *Recorder) Dump(w io.Writer, format Format) error {
+	return dumpTicks(w, format, r.Ticks())
+}
+
+func dumpTicks(w io.Writer, format Format, ticks []Tick) error {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+		for _, t := range ticks {
+			if err := cw.Write([]string{
+				t.Time.Format(time.RFC3339Nano),
+				formatFloat(t.CPUUsage), formatFloat(t.SetPoint),
+				formatFloat(t.P), formatFloat(t.I), formatFloat(t.D), formatFloat(t.Output),
+				strconv.FormatBool(t.Overload),
+			}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case FormatJSONLines:
+		bw := bufio.NewWriter(w)
+		enc := json.NewEncoder(bw)
+		for _, t := range ticks {
+			if err := enc.Encode(t); err != nil {
+				return err
+			}
+		}
+		return bw.Flush()
+	}
+	return fmt.Errorf("unknown recorder format %q", format)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
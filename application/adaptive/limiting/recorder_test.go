@@ -0,0 +1,95 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package limiting
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytedance/pid_limits/util/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder(3)
+	assert.Empty(t, r.Ticks())
+	for i := 1; i <= 5; i++ {
+		r.Record(Tick{CPUUsage: float64(i)})
+	}
+	ticks := r.Ticks()
+	require.Len(t, ticks, 3)
+	assert.Equal(t, []float64{3, 4, 5}, []float64{ticks[0].CPUUsage, ticks[1].CPUUsage, ticks[2].CPUUsage})
+}
+
+func TestRecorderDump(t *testing.T) {
+	r := NewRecorder(10)
+	at := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	r.Record(Tick{Time: at, CPUUsage: 0.95, SetPoint: 0.8, P: -802.7, I: -12.5, D: 0, Output: -815.2, Overload: true})
+	r.Record(Tick{Time: at.Add(100 * time.Millisecond), CPUUsage: 0.5, SetPoint: 0.8})
+
+	var buf bytes.Buffer
+	require.NoError(t, r.Dump(&buf, FormatCSV))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		csvHeader,
+		{"2021-06-01T12:00:00Z", "0.95", "0.8", "-802.7", "-12.5", "0", "-815.2", "true"},
+		{"2021-06-01T12:00:00.1Z", "0.5", "0.8", "0", "0", "0", "0", "false"},
+	}, records)
+
+	buf.Reset()
+	require.NoError(t, r.Dump(&buf, FormatJSONLines))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	var tick Tick
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &tick))
+	assert.Equal(t, r.Ticks()[0], tick)
+
+	assert.Error(t, r.Dump(&buf, "xml"))
+}
+
+func TestPIDLimitingAutoDump(t *testing.T) {
+	dir := t.TempDir()
+	l := &PIDLimiting{
+		name:       "dump",
+		rate:       3000,
+		monitor:    &fakeMonitor{},
+		logger:     logging.Nop(),
+		recorder:   NewRecorder(10),
+		dumpDir:    dir,
+		dumpFormat: FormatJSONLines,
+	}
+	l.recorder.Record(Tick{CPUUsage: 0.9, Overload: true})
+	l.observe(0.9, true)
+	l.observe(0.5, false)
+
+	var files []string
+	require.Eventually(t, func() bool {
+		files, _ = filepath.Glob(filepath.Join(dir, "dump-*.jsonl"))
+		return len(files) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		data, _ := os.ReadFile(files[0])
+		return strings.Count(string(data), "\n") == 1
+	}, time.Second, 10*time.Millisecond)
+}
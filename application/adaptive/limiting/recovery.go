@@ -0,0 +1,72 @@
+package limiting
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/config"
+)
+
+// exponentialDecay makes the exponential curve reach 1% of the initial ratio at the end of the window
+var exponentialDecay = math.Log(100)
+
+// recovery is the reject ratio ramp after an overload ends, a zero recovery is no ramp
+type recovery struct {
+	start time.Time
+	from  float64
+}
+
+// ratio is the reject ratio of the ramp at now, it is 0 once the window elapsed
+func (r recovery) ratio(now time.Time, window time.Duration, curve string) float64 {
+	elapsed := now.Sub(r.start)
+	if r.from <= 0 || window <= 0 || elapsed >= window {
+		return 0
+	}
+	progress := math.Max(0, float64(elapsed)/float64(window))
+	if curve == config.RecoveryExponential {
+		return r.from * math.Exp(-exponentialDecay*progress)
+	}
+	return r.from * (1 - progress)
+}
+
+// recoveryRatio is the reject ratio of the ramp in progress, 0 if there is none
+func (l *PIDLimiting) recoveryRatio() float64 {
+	r, _ := l.ramp.Load().(recovery)
+	option := l.currentOptions()
+	if r.from == 0 || option == nil {
+		return 0
+	}
+	return r.ratio(time.Now(), option.RecoveryWindow, option.RecoveryCurve)
+}
+
+// rampTick starts the ramp from the last reject ratio when the overload ends, an overload cancels it and a cpu usage
+// above the set point holds it at its current ratio. It is only called by the control loop
+func (l *PIDLimiting) rampTick(cpuUsage float64, overloaded bool, option *config.Options, now time.Time) {
+	if overloaded {
+		l.shedRatio = math.Min(10000, math.Max(0, float64(atomic.LoadUint32(&l.rate))))
+		l.ramp.Store(recovery{})
+		return
+	}
+	if l.shedRatio > 0 {
+		if option.RecoveryWindow > 0 {
+			l.ramp.Store(recovery{start: now, from: l.shedRatio})
+			l.log().Info("recovery started", "name", l.name, "ratio", l.shedRatio, "window", option.RecoveryWindow)
+		}
+		l.shedRatio = 0
+		return
+	}
+	r, _ := l.ramp.Load().(recovery)
+	if r.from == 0 {
+		return
+	}
+	ratio := r.ratio(now, option.RecoveryWindow, option.RecoveryCurve)
+	switch {
+	case ratio == 0:
+		l.ramp.Store(recovery{})
+		l.log().Info("recovery ended", "name", l.name)
+	case cpuUsage > l.setPoint():
+		l.ramp.Store(recovery{start: now, from: ratio})
+		l.log().Debug("recovery held", "name", l.name, "cpu", cpuUsage, "ratio", ratio)
+	}
+}
@@ -0,0 +1,70 @@
+package limiting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/config"
+	"github.com/bytedance/pid_limits/util/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoveryRatio(t *testing.T) {
+	start := time.UnixMilli(1000000)
+	r := recovery{start: start, from: 4000}
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	assert.Equal(t, float64(4000), r.ratio(start, 10*time.Second, config.RecoveryLinear))
+	assert.Equal(t, float64(3000), r.ratio(at(2500*time.Millisecond), 10*time.Second, config.RecoveryLinear))
+	assert.Equal(t, float64(0), r.ratio(at(10*time.Second), 10*time.Second, config.RecoveryLinear))
+	assert.InDelta(t, 400, r.ratio(at(5*time.Second), 10*time.Second, config.RecoveryExponential), 1e-9)
+	assert.InDelta(t, 40, r.ratio(at(10*time.Second-time.Nanosecond), 10*time.Second, config.RecoveryExponential), 1e-6)
+	assert.Equal(t, float64(0), r.ratio(at(time.Second), 0, config.RecoveryLinear))
+	assert.Equal(t, float64(0), recovery{}.ratio(start, 10*time.Second, config.RecoveryLinear))
+}
+
+func TestRampTick(t *testing.T) {
+	monitor := &fakeMonitor{overload: true}
+	l := &PIDLimiting{rate: 5000, monitor: monitor, logger: logging.Nop()}
+	option := config.NewOptions()
+	config.WithRecovery(10*time.Second, config.RecoveryLinear)(option)
+	l.options.Store(option)
+	now := time.Now()
+
+	l.rampTick(0.9, true, option, now)
+	assert.Equal(t, float64(5000), l.ratio())
+
+	// the overload ends, the ratio decays from the last overloaded ratio
+	monitor.overload = false
+	l.rate = 0
+	l.rampTick(0.5, false, option, now)
+	assert.InDelta(t, 5000, l.ratio(), 10)
+	l.ramp.Store(recovery{start: now.Add(-5 * time.Second), from: 5000})
+	assert.InDelta(t, 2500, l.ratio(), 10)
+
+	// a cpu usage above the set point holds the ramp
+	l.rampTick(0.9, false, option, now)
+	held := l.ramp.Load().(recovery)
+	assert.Equal(t, now, held.start)
+	assert.InDelta(t, 2500, held.from, 1e-9)
+
+	// an overload cancels the ramp and the pid takes over
+	l.rampTick(0.9, true, option, now)
+	assert.Equal(t, recovery{}, l.ramp.Load().(recovery))
+
+	// the ramp ends once the window elapsed
+	l.ramp.Store(recovery{start: now.Add(-time.Minute), from: 5000})
+	l.shedRatio = 0
+	l.rampTick(0.5, false, option, now)
+	assert.Equal(t, recovery{}, l.ramp.Load().(recovery))
+	assert.Equal(t, float64(0), l.ratio())
+}
+
+func TestRampTickDisabled(t *testing.T) {
+	l := &PIDLimiting{rate: 5000, monitor: &fakeMonitor{}, logger: logging.Nop()}
+	option := config.NewOptions()
+	l.options.Store(option)
+	l.rampTick(0.9, true, option, time.Now())
+	l.rampTick(0.5, false, option, time.Now())
+	assert.Equal(t, float64(0), l.ratio())
+}
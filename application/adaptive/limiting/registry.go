@@ -0,0 +1,96 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package limiting
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/bytedance/pid_limits/util/logging"
+)
+
+// NamedLimit is a limiter registered under a name, see Register
+type NamedLimit struct {
+	Name  string
+	Limit RateLimit
+}
+
+// StatsLimit is implemented by limiters exposing their counters
+type StatsLimit interface {
+	Stats() Stats
+}
+
+// OverloadLimit is implemented by limiters driven by a cpu monitor
+type OverloadLimit interface {
+	Overloaded() bool
+}
+
+var registry = struct {
+	sync.RWMutex
+	limits map[string]RateLimit
+	seq    map[string]int
+}{limits: map[string]RateLimit{}, seq: map[string]int{}}
+
+// Register makes l visible to the exporters under name, a limiter already registered under name is replaced.
+// The limiters created by this package register themselves, with the name of config.WithName or kind-N
+func Register(name string, l RateLimit) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.limits[name]; ok {
+		logging.Warn("limiter replaced in registry", "name", name)
+	}
+	registry.limits[name] = l
+}
+
+func Unregister(name string) {
+	registry.Lock()
+	defer registry.Unlock()
+	delete(registry.limits, name)
+}
+
+func Lookup(name string) (RateLimit, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	l, ok := registry.limits[name]
+	return l, ok
+}
+
+// Limiters returns the registered limiters sorted by name
+func Limiters() []NamedLimit {
+	registry.RLock()
+	limits := make([]NamedLimit, 0, len(registry.limits))
+	for name, l := range registry.limits {
+		limits = append(limits, NamedLimit{Name: name, Limit: l})
+	}
+	registry.RUnlock()
+	sort.Slice(limits, func(i, j int) bool {
+		return limits[i].Name < limits[j].Name
+	})
+	return limits
+}
+
+// register registers l under name, or under kind-N when name is empty, and returns the name used
+func register(kind, name string, l RateLimit) string {
+	if name == "" {
+		registry.Lock()
+		registry.seq[kind]++
+		name = kind + "-" + strconv.Itoa(registry.seq[kind])
+		registry.Unlock()
+	}
+	Register(name, l)
+	return name
+}
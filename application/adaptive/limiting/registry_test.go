@@ -0,0 +1,45 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package limiting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	a, b := &ratioLimit{}, &ratioLimit{}
+	Register("test-b", b)
+	name := register("test", "", a)
+	defer Unregister("test-b")
+	defer Unregister(name)
+
+	assert.Equal(t, "test-1", name)
+	l, ok := Lookup("test-1")
+	assert.True(t, ok)
+	assert.Equal(t, RateLimit(a), l)
+
+	var names []string
+	for _, nl := range Limiters() {
+		names = append(names, nl.Name)
+	}
+	assert.Subset(t, names, []string{"test-1", "test-b"})
+
+	Unregister("test-b")
+	_, ok = Lookup("test-b")
+	assert.False(t, ok)
+}
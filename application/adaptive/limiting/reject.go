@@ -0,0 +1,44 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package limiting
+
+import (
+	"math"
+	"time"
+)
+
+// RejectInfo describes the limiter when a request was rejected
+type RejectInfo struct {
+	CPUUsage float64
+	// Ratio is the reject ratio at decision time, 0 ~ 10000
+	Ratio float64
+	// RetryAfter is the suggested delay before the caller retries, 0 when disabled
+	RetryAfter time.Duration
+}
+
+// RetryAfter scales the delay by the reject ratio from one second up to max, rounded up to whole seconds,
+// the harder the instance sheds the longer the callers should back off
+func RetryAfter(ratio float64, max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	ratio = math.Min(10000, math.Max(0, ratio))
+	delay := time.Second + time.Duration(ratio/10000*float64(max-time.Second))
+	if delay < time.Second {
+		return time.Second
+	}
+	return time.Duration(math.Ceil(delay.Seconds())) * time.Second
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package limiting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), RetryAfter(5000, 0))
+	assert.Equal(t, time.Second, RetryAfter(0, 10*time.Second))
+	assert.Equal(t, 6*time.Second, RetryAfter(5000, 10*time.Second))
+	assert.Equal(t, 10*time.Second, RetryAfter(20000, 10*time.Second))
+	assert.Equal(t, time.Second, RetryAfter(5000, time.Millisecond))
+}
@@ -0,0 +1,275 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package limiting
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/config"
+	"github.com/bytedance/pid_limits/core/stat"
+	"github.com/bytedance/pid_limits/util"
+)
+
+const (
+	tenantBuckets = 10
+	// the fair share of every tenant is recomputed at most once per interval
+	tenantRecalcInterval = 100 * time.Millisecond
+	// tenantShards splits the tenants so that requests of different tenants rarely wait on the same lock
+	tenantShards = 16
+)
+
+// TenantLimit is implemented by limiters that shed by tenant
+type TenantLimit interface {
+	RateLimit
+	LimitTenant(tenant string) bool
+}
+
+type tenantStat struct {
+	requests *stat.RollingWindow
+	lastSeen int64  // unix nanoseconds, accessed atomically
+	ratio    uint64 // bits of the reject probability of the tenant, 0 ~ 10000, accessed atomically
+}
+
+func (ts *tenantStat) loadRatio() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&ts.ratio))
+}
+
+func (ts *tenantStat) storeRatio(ratio float64) {
+	atomic.StoreUint64(&ts.ratio, math.Float64bits(ratio))
+}
+
+type tenantShard struct {
+	mu      sync.Mutex
+	tenants map[string]*tenantStat
+}
+
+// TenantLimiting wraps a RateLimit, the overall reject ratio of the wrapped limiter is taken from the tenants
+// exceeding their fair share, in proportion to how far they exceed it, so one abusive caller cannot crowd out the others.
+// The tenants are sharded, a request only locks the shard of its tenant, and the shares are recomputed by one request
+// per interval without blocking the others
+type TenantLimiting struct {
+	name       string
+	limit      RateLimit
+	shardLimit int
+	window     time.Duration
+	shards     []tenantShard
+	lastRecalc int64 // unix nanoseconds, accessed atomically
+	now        func() time.Time
+}
+
+func NewTenantLimiting(limit RateLimit, opts ...config.OptionFunc) *TenantLimiting {
+	option := config.NewOptions()
+	for _, opt := range opts {
+		opt(option)
+	}
+	if option.MaxTenants <= 0 {
+		option.MaxTenants = 1
+	}
+	shards := tenantShards
+	if option.MaxTenants < shards {
+		shards = option.MaxTenants
+	}
+	l := &TenantLimiting{
+		limit:      limit,
+		shardLimit: option.MaxTenants / shards,
+		window:     option.TenantWindow,
+		shards:     make([]tenantShard, shards),
+		now:        time.Now,
+	}
+	for i := range l.shards {
+		l.shards[i].tenants = make(map[string]*tenantStat)
+	}
+	l.name = register("tenant", option.Name, l)
+	return l
+}
+
+func (l *TenantLimiting) Limit() bool {
+	if ratio, ok := override(l.name); ok {
+		return float64(util.Uint32n(10000)) < ratio
+	}
+	return l.limit.Limit()
+}
+
+// LimitRatio is the ratio of the wrapped limiter, unless overridden by the control registry
+func (l *TenantLimiting) LimitRatio() float64 {
+	if ratio, ok := override(l.name); ok {
+		return ratio
+	}
+	return l.limit.LimitRatio()
+}
+
+// LimitTenant records the request of the tenant and decides whether it should be rejected
+func (l *TenantLimiting) LimitTenant(tenant string) bool {
+	reject, _ := l.limitTenantShadow(tenant)
+	return reject
+}
+
+// limitTenantShadow is LimitTenantShadow for a request without a tier, it is shed by the ratio of the tenant
+func (l *TenantLimiting) limitTenantShadow(tenant string) (reject bool, wouldReject bool) {
+	return l.decide(l.tenantRatio(tenant, l.shadowRatio()))
+}
+
+// LimitTenantShadow is LimitTenant for a request with a priority tier, the ratio of the tenant is spread across the tiers
+// when the wrapped limiter supports them. When the wrapped limiter is in dry-run mode nothing is rejected,
+// the decision that would have been made is reported and counted by the wrapped limiter
+func (l *TenantLimiting) LimitTenantShadow(tenant string, p Priority) (reject bool, wouldReject bool) {
+	ratio := l.tenantRatio(tenant, l.shadowRatio())
+	if _, ok := l.limit.(PriorityLimit); ok {
+		ratio = priorityRatio(ratio, p)
+	}
+	return l.decide(ratio)
+}
+
+// TenantRatio records the request of the tenant and returns its reject ratio, 0 ~ 10000
+func (l *TenantLimiting) TenantRatio(tenant string) float64 {
+	return l.tenantRatio(tenant, l.LimitRatio())
+}
+
+// shadowRatio is LimitRatio, except that a wrapped limiter in dry-run mode reports the ratio it would apply
+func (l *TenantLimiting) shadowRatio() float64 {
+	if ratio, ok := override(l.name); ok {
+		return ratio
+	}
+	if s, ok := l.limit.(shadowDecider); ok {
+		return s.ratio()
+	}
+	return l.limit.LimitRatio()
+}
+
+func (l *TenantLimiting) decide(ratio float64) (bool, bool) {
+	reject := float64(util.Uint32n(10000)) < ratio
+	if s, ok := l.limit.(shadowDecider); ok {
+		return s.shadow(reject)
+	}
+	return reject, false
+}
+
+func (l *TenantLimiting) tenantRatio(tenant string, ratio float64) float64 {
+	now := l.now()
+	ts := l.tenant(tenant, now)
+	ts.requests.Add(1)
+	if ratio <= 0 {
+		return 0
+	}
+	last := atomic.LoadInt64(&l.lastRecalc)
+	if now.UnixNano()-last >= int64(tenantRecalcInterval) && atomic.CompareAndSwapInt64(&l.lastRecalc, last, now.UnixNano()) {
+		l.recalc(ratio)
+	}
+	return ts.loadRatio()
+}
+
+func (l *TenantLimiting) shard(name string) *tenantShard {
+	// fnv-1a, inlined to hash without allocating
+	h := uint32(2166136261)
+	for i := 0; i < len(name); i++ {
+		h ^= uint32(name[i])
+		h *= 16777619
+	}
+	return &l.shards[h%uint32(len(l.shards))]
+}
+
+func (l *TenantLimiting) tenant(name string, now time.Time) *tenantStat {
+	shard := l.shard(name)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	ts, ok := shard.tenants[name]
+	if !ok {
+		if len(shard.tenants) >= l.shardLimit {
+			shard.evict()
+		}
+		ts = &tenantStat{
+			requests: stat.NewRollingWindowWithClock(tenantBuckets, l.window/tenantBuckets, l.now),
+		}
+		shard.tenants[name] = ts
+	}
+	atomic.StoreInt64(&ts.lastSeen, now.UnixNano())
+	return ts
+}
+
+// evict removes the tenant of the shard seen least recently
+func (s *tenantShard) evict() {
+	var oldest string
+	var oldestSeen int64
+	for name, ts := range s.tenants {
+		if seen := atomic.LoadInt64(&ts.lastSeen); oldest == "" || seen < oldestSeen {
+			oldest, oldestSeen = name, seen
+		}
+	}
+	delete(s.tenants, oldest)
+}
+
+// recalc finds the cap of requests per tenant by water filling, so that the requests above the cap
+// add up to ratio of all requests, every tenant above the cap is rejected by its excess.
+// The shards are only locked to list their tenants
+func (l *TenantLimiting) recalc(ratio float64) {
+	var names []string
+	stats := make(map[string]*tenantStat)
+	for i := range l.shards {
+		shard := &l.shards[i]
+		shard.mu.Lock()
+		for name, ts := range shard.tenants {
+			names = append(names, name)
+			stats[name] = ts
+		}
+		shard.mu.Unlock()
+	}
+	rates := make(map[string]float64, len(names))
+	var total float64
+	for _, name := range names {
+		var sum int64
+		stats[name].requests.Reduce(func(b stat.Bucket) {
+			sum += b.Sum
+		})
+		rates[name] = float64(sum)
+		total += float64(sum)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return rates[names[i]] < rates[names[j]]
+	})
+	ceiling := waterFill(names, rates, total, total*ratio/10000)
+	for _, name := range names {
+		ts, rate := stats[name], rates[name]
+		switch {
+		case rate <= 0:
+			// no history of the tenant yet, fall back to the overall ratio
+			ts.storeRatio(ratio)
+		case rate <= ceiling:
+			ts.storeRatio(0)
+		default:
+			ts.storeRatio((rate - ceiling) / rate * 10000)
+		}
+	}
+}
+
+// waterFill returns the cap c so that sum(max(0, rate - c)) equals shed, names must be sorted by rate ascending
+func waterFill(names []string, rates map[string]float64, total, shed float64) float64 {
+	remaining := total
+	for i, name := range names {
+		c := (remaining - shed) / float64(len(names)-i)
+		if c <= rates[name] {
+			if c < 0 {
+				return 0
+			}
+			return c
+		}
+		remaining -= rates[name]
+	}
+	return 0
+}
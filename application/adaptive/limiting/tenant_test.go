@@ -0,0 +1,154 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package limiting
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type ratioLimit struct {
+	ratio float64
+}
+
+func (l *ratioLimit) Limit() bool {
+	return false
+}
+
+func (l *ratioLimit) LimitRatio() float64 {
+	return l.ratio
+}
+
+func TestTenantLimiting(t *testing.T) {
+	now := time.UnixMilli(1000000)
+	base := &ratioLimit{}
+	l := NewTenantLimiting(base, config.WithTenantWindow(2*time.Second))
+	l.now = func() time.Time { return now }
+
+	send := func(tenant string, n int) (rejected int) {
+		for i := 0; i < n; i++ {
+			if l.LimitTenant(tenant) {
+				rejected++
+			}
+		}
+		return
+	}
+	assert.Equal(t, 0, send("a", 80))
+	assert.Equal(t, 0, send("b", 10))
+	assert.Equal(t, 0, send("c", 10))
+	now = now.Add(200 * time.Millisecond)
+
+	// 50% has to be shed: the cap is 30, only a is above it
+	base.ratio = 5000
+	send("a", 1)
+	assert.InDelta(t, 6250, tenantOf(l, "a").loadRatio(), 1e-9)
+	assert.Equal(t, float64(0), tenantOf(l, "b").loadRatio())
+	assert.Equal(t, 0, send("b", 100))
+	assert.Equal(t, 0, send("c", 100))
+
+	// a new tenant without history is shed by the overall ratio
+	now = now.Add(200 * time.Millisecond)
+	send("d", 1)
+	send("a", 1)
+	assert.Equal(t, float64(5000), tenantOf(l, "d").loadRatio())
+}
+
+func TestTenantLimitingDryRun(t *testing.T) {
+	base := &PIDLimiting{rate: 10000, monitor: &fakeMonitor{overload: true}, dryRun: true}
+	a := NewAdmission(base, true)
+	l := a.tenant.(*TenantLimiting)
+	for i := 0; i < 10; i++ {
+		reject, wouldReject := a.Limit(PriorityDefault, false, "a")
+		assert.False(t, reject)
+		assert.True(t, wouldReject)
+	}
+	assert.False(t, l.LimitTenant("a"))
+	assert.Equal(t, float64(0), l.TenantRatio("a"))
+	assert.Equal(t, uint64(11), base.Stats().ShadowRejected)
+	assert.Equal(t, uint64(0), base.Stats().Rejected)
+
+	base.dryRun = false
+	reject, wouldReject := a.Limit(PriorityBackground, true, "a")
+	assert.True(t, reject)
+	assert.False(t, wouldReject)
+}
+
+// tenantOf is the stat of a tenant, nil if it is not tracked
+func tenantOf(l *TenantLimiting, name string) *tenantStat {
+	shard := l.shard(name)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.tenants[name]
+}
+
+func tenantCount(l *TenantLimiting) int {
+	count := 0
+	for i := range l.shards {
+		count += len(l.shards[i].tenants)
+	}
+	return count
+}
+
+func TestTenantLimitingEvict(t *testing.T) {
+	now := time.UnixMilli(1000000)
+	l := NewTenantLimiting(&ratioLimit{}, config.WithMaxTenants(1))
+	l.now = func() time.Time { return now }
+	l.LimitTenant("a")
+	now = now.Add(time.Millisecond)
+	l.LimitTenant("b")
+	assert.Equal(t, 1, tenantCount(l))
+	assert.Nil(t, tenantOf(l, "a"))
+
+	// the tenants are sharded, every shard evicts its own least recently seen tenant
+	l = NewTenantLimiting(&ratioLimit{}, config.WithMaxTenants(64))
+	l.now = func() time.Time { return now }
+	for i := 0; i < 1000; i++ {
+		now = now.Add(time.Millisecond)
+		l.LimitTenant(strconv.Itoa(i))
+	}
+	assert.True(t, tenantCount(l) <= 64)
+	assert.NotNil(t, tenantOf(l, "999"))
+}
+
+func TestTenantLimitingConcurrent(t *testing.T) {
+	base := &ratioLimit{ratio: 5000}
+	l := NewTenantLimiting(base, config.WithMaxTenants(32))
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				l.LimitTenant(strconv.Itoa(g*100 + i%50))
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.True(t, tenantCount(l) <= 32)
+}
+
+func TestWaterFill(t *testing.T) {
+	names := []string{"b", "c", "a"}
+	rates := map[string]float64{"a": 80, "b": 10, "c": 10}
+	assert.InDelta(t, 30, waterFill(names, rates, 100, 50), 1e-9)
+	assert.InDelta(t, 10, waterFill(names, rates, 100, 70), 1e-9)
+	assert.Equal(t, float64(0), waterFill(names, rates, 100, 100))
+}
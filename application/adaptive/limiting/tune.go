@@ -25,6 +25,7 @@ func NewPidTunerLimiting(setPoint float64) *PIDTune {
 		tuner: &pid.Tuner{},
 	}
 	t.tuner.Init(setPoint)
+	t.name = register("tune", "", tuneLimit{t})
 	t.start()
 	return t
 }
@@ -24,6 +24,7 @@ import (
 )
 
 type PIDTune struct {
+	name  string
 	rate  uint32
 	tuner *pid.Tuner
 }
@@ -40,10 +41,22 @@ func (t *PIDTune) start() {
 }
 
 func (t *PIDTune) Limit() bool {
-	return util.Uint32n(10000) < -atomic.LoadUint32(&t.rate)
+	return util.Uint32n(10000) < t.LimitRatio()
 }
 
 // Rate the probability is form 0 ~ 10000
 func (t *PIDTune) LimitRatio() uint32 {
+	if ratio, ok := override(t.name); ok {
+		return uint32(ratio)
+	}
 	return -atomic.LoadUint32(&t.rate)
 }
+
+// tuneLimit registers a PIDTune, whose LimitRatio returns an uint32 and does not implement RateLimit
+type tuneLimit struct {
+	*PIDTune
+}
+
+func (t tuneLimit) LimitRatio() float64 {
+	return float64(t.PIDTune.LimitRatio())
+}
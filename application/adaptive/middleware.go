@@ -17,61 +17,115 @@ package adaptive
 
 import (
 	"fmt"
-	"math/rand"
+	"net/http"
 	"time"
 
 	"github.com/bytedance/pid_limits/application/adaptive/config"
 	"github.com/bytedance/pid_limits/application/adaptive/limiting"
-	"github.com/bytedance/pid_limits/arithmetic/pid"
-	"github.com/bytedance/pid_limits/core/system"
+	"github.com/bytedance/pid_limits/application/adaptive/limiting/concurrency"
+	"github.com/bytedance/pid_limits/application/adaptive/route"
 	"github.com/gin-gonic/gin"
 )
 
-type tunePID struct {
-	rate float64
+func PlatoMiddlewareGinDefault(threshold float64, opts ...config.OptionFunc) gin.HandlerFunc {
+	return PlatoMiddlewareGinWithLimit(limiting.NewPidLimitingHttpDefault(threshold, opts...))
 }
 
-func (t *tunePID) initTuner(threshold float64) {
-	tuner := &pid.Tuner{}
-	tuner.Init(threshold)
-	go func() {
-		for {
-			t.rate = tuner.TunePID(system.CurrentCPUUsage())
-			time.Sleep(100 * time.Millisecond)
-		}
-	}()
+func PlatoMiddlewareGin(kp float64, ki float64, kd float64, threshold float64, opts ...config.OptionFunc) gin.HandlerFunc {
+	return PlatoMiddlewareGinWithLimit(limiting.NewPidLimiting(kp, ki, kd, threshold, opts...))
 }
 
-func PlatoMiddlewareGinDefault(threshold float64, opts ...config.OptionFunc) gin.HandlerFunc {
-	limit := limiting.NewPidLimitingHttpDefault(threshold, opts...)
+// PlatoMiddlewareGinWithLimit works with any RateLimit, eg. PIDLimiting or BBRLimiting,
+// limiters implementing limiting.Completer are told the rt of every admitted request,
+// limiters implementing limiting.PriorityLimit shed requests carrying a tier by their priority,
+// and with a tenant option the limiter is wrapped by a limiting.TenantLimiting to shed tenants by their fair share
+func PlatoMiddlewareGinWithLimit(limit limiting.RateLimit, opts ...MiddlewareOption) gin.HandlerFunc {
+	options := newMiddlewareOptions(opts)
+	tenantAware := options.tenant != nil
+	routes := make([]routeAdmission, 0, len(options.routes))
+	for _, r := range options.routes {
+		routes = append(routes, routeAdmission{matcher: r.matcher, admission: limiting.NewAdmission(r.limit, tenantAware)})
+	}
+	defaultAdmission := limiting.NewAdmission(limit, tenantAware)
 	return func(c *gin.Context) {
-		if limit.Limit() {
-			_ = c.AbortWithError(510, fmt.Errorf("block by pid"))
+		reqPath, fullPath := c.Request.URL.Path, c.FullPath()
+		if !options.filter.Limited(reqPath, fullPath) {
+			c.Next()
+			return
+		}
+		admission := defaultAdmission
+		for _, r := range routes {
+			if r.matcher.Match(reqPath, fullPath) {
+				admission = r.admission
+				break
+			}
+		}
+		p, hasPriority := options.priority(c)
+		var tenant string
+		if tenantAware {
+			tenant = options.tenant(c)
+		}
+		reject, wouldReject := admission.Limit(p, hasPriority, tenant)
+		if reject {
+			options.reject(c, admission.RejectInfo(options.maxRetryAfter))
 			return
 		}
+		if wouldReject {
+			options.shadowReject(c)
+		}
+		if !admission.Tracked() {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		// deferred, so a panicking handler does not leave the request in flight for good
+		defer func() {
+			admission.Complete(time.Since(start))
+		}()
 		c.Next()
 	}
 }
 
-func PlatoMiddlewareGin(kp float64, ki float64, kd float64, threshold float64, opts ...config.OptionFunc) gin.HandlerFunc {
-	limit := limiting.NewPidLimiting(kp, ki, kd, threshold, opts...)
+type routeAdmission struct {
+	matcher   route.Matcher
+	admission *limiting.Admission
+}
+
+// TunePIDMiddlewareGin sheds requests by a limiting.PIDTune, it is registered so the kill switch applies to it
+func TunePIDMiddlewareGin(threshold float64) gin.HandlerFunc {
+	tune := limiting.NewPidTunerLimiting(threshold)
 	return func(c *gin.Context) {
-		if limit.Limit() {
-			_ = c.AbortWithError(510, fmt.Errorf("block by pid"))
+		if tune.Limit() {
+			_ = c.AbortWithError(defaultRejectStatus, errBlockByPid)
 			return
 		}
 		c.Next()
 	}
 }
 
-func TunePIDMiddlewareGin(threshold float64) gin.HandlerFunc {
-	tPID := &tunePID{rate: 0}
-	tPID.initTuner(threshold)
+// ConcurrencyMiddlewareGin limits the in-flight requests by an adaptive concurrency limiter,
+// a 503 or 504 written by the handler, or a panic, is reported to the limiter as a drop.
+// The limiters of package concurrency admit every request while limiting.DisableAll is in effect
+func ConcurrencyMiddlewareGin(limiter concurrency.Limiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if rand.Intn(10000) < int(-tPID.rate) {
-			_ = c.AbortWithError(510, fmt.Errorf("block by pid"))
+		token, ok := limiter.Acquire()
+		if !ok {
+			_ = c.AbortWithError(defaultRejectStatus, fmt.Errorf("block by concurrency limit"))
 			return
 		}
+		// finish the token even if the handler panics, otherwise its slot is never given back
+		defer func() {
+			if r := recover(); r != nil {
+				token.Drop()
+				panic(r)
+			}
+			switch c.Writer.Status() {
+			case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				token.Drop()
+			default:
+				token.Release()
+			}
+		}()
 		c.Next()
 	}
 }
@@ -0,0 +1,270 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package adaptive
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/bytedance/pid_limits/application/adaptive/route"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultPriorityHeader is not read unless enabled by WithPriorityHeader, any client could claim a tier by it
+	DefaultPriorityHeader     = "X-Request-Priority"
+	DefaultPriorityContextKey = "plato_priority"
+	// DefaultDryRunHeader is set on responses of requests a dry-run limiter would have rejected
+	DefaultDryRunHeader = "X-Plato-Shadow-Reject"
+	// ShadowRejectContextKey is set to true in the gin context when a dry-run limiter would have rejected the request
+	ShadowRejectContextKey = "plato_shadow_reject"
+
+	defaultRejectStatus  = http.StatusTooManyRequests
+	defaultMaxRetryAfter = 10 * time.Second
+)
+
+var (
+	errBlockByPid = errors.New("block by pid")
+)
+
+// RejectInfo is passed to the OnReject hook
+type RejectInfo = limiting.RejectInfo
+
+type middlewareOptions struct {
+	priorityHeader     string
+	priorityContextKey string
+	priorityFunc       func(c *gin.Context) (limiting.Priority, bool)
+	tenant             func(c *gin.Context) string
+	rejectStatus       int
+	maxRetryAfter      time.Duration
+	rejectContentType  string
+	rejectBody         *template.Template
+	onReject           func(c *gin.Context, info RejectInfo)
+	filter             route.Filter
+	routes             []routeLimit
+	dryRunHeader       string
+}
+
+type routeLimit struct {
+	matcher route.Matcher
+	limit   limiting.RateLimit
+}
+
+// MiddlewareOption configures the gin middleware built by PlatoMiddlewareGinWithLimit
+type MiddlewareOption func(*middlewareOptions)
+
+func newMiddlewareOptions(opts []MiddlewareOption) *middlewareOptions {
+	options := &middlewareOptions{
+		priorityContextKey: DefaultPriorityContextKey,
+		rejectStatus:       defaultRejectStatus,
+		maxRetryAfter:      defaultMaxRetryAfter,
+		dryRunHeader:       DefaultDryRunHeader,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// WithPriorityHeader reads the request tier, eg. "batch" or "2", from header, eg. DefaultPriorityHeader. Only enable
+// it for trusted callers or behind a proxy that overwrites the header, otherwise anyone can skip shedding as critical
+func WithPriorityHeader(header string) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.priorityHeader = header
+	}
+}
+
+// WithPriorityContextKey sets the gin context key carrying the request tier, the value can be a
+// limiting.Priority or a string, it takes precedence over the header
+func WithPriorityContextKey(key string) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.priorityContextKey = key
+	}
+}
+
+// WithDryRunHeader sets the response header marking requests a dry-run limiter would have rejected,
+// an empty name disables it
+func WithDryRunHeader(header string) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.dryRunHeader = header
+	}
+}
+
+// ShadowRejected reports whether a dry-run limiter would have rejected the request
+func ShadowRejected(c *gin.Context) bool {
+	return c.GetBool(ShadowRejectContextKey)
+}
+
+func (o *middlewareOptions) shadowReject(c *gin.Context) {
+	c.Set(ShadowRejectContextKey, true)
+	if o.dryRunHeader != "" {
+		c.Header(o.dryRunHeader, "1")
+	}
+}
+
+// WithPriorityExtractor sets a custom source of the request tier, eg. tiers by route from a config file,
+// it is consulted after the context key and before the header
+func WithPriorityExtractor(f func(c *gin.Context) (limiting.Priority, bool)) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.priorityFunc = f
+	}
+}
+
+// WithRejectStatus sets the status code of rejected requests, 429 by default, 503 is the other common choice
+func WithRejectStatus(status int) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.rejectStatus = status
+	}
+}
+
+// WithRetryAfter sets the upper bound of the Retry-After header, it grows with the reject ratio from one second to max,
+// 0 disables the header
+func WithRetryAfter(max time.Duration) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.maxRetryAfter = max
+	}
+}
+
+// WithRejectBody sets the body of rejected requests, tpl is a text/template executed with the RejectInfo,
+// eg. `{"code": 429, "ratio": {{.Ratio}}}`, it panics if tpl cannot be parsed
+func WithRejectBody(contentType string, tpl string) MiddlewareOption {
+	t := template.Must(template.New("reject").Parse(tpl))
+	return func(options *middlewareOptions) {
+		options.rejectContentType = contentType
+		options.rejectBody = t
+	}
+}
+
+// WithRejectJSON is WithRejectBody with a json content type
+func WithRejectJSON(tpl string) MiddlewareOption {
+	return WithRejectBody("application/json; charset=utf-8", tpl)
+}
+
+// WithRejectText is WithRejectBody with a plain text content type
+func WithRejectText(tpl string) MiddlewareOption {
+	return WithRejectBody("text/plain; charset=utf-8", tpl)
+}
+
+// WithOnReject sets a hook called for every rejected request with the cpu usage and the reject ratio at decision time,
+// if the hook aborts the context it owns the response, otherwise the default response is written after it
+func WithOnReject(f func(c *gin.Context, info RejectInfo)) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.onReject = f
+	}
+}
+
+// WithInclude limits only the requests matching one of the matchers, eg. route.Prefix("/api")
+func WithInclude(matchers ...route.Matcher) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.filter.Include = append(options.filter.Include, matchers...)
+	}
+}
+
+// WithExclude exempts the requests matching one of the matchers from shedding, eg. health checks or metrics scraping,
+// it wins over WithInclude
+func WithExclude(matchers ...route.Matcher) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.filter.Exclude = append(options.filter.Exclude, matchers...)
+	}
+}
+
+// WithRouteLimit gives the requests matching one of the matchers their own limiter, routes are tried in the order
+// they are added and the limiter passed to the middleware applies to everything else
+func WithRouteLimit(limit limiting.RateLimit, matchers ...route.Matcher) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.routes = append(options.routes, routeLimit{matcher: route.Any(matchers...), limit: limit})
+	}
+}
+
+func (o *middlewareOptions) reject(c *gin.Context, info RejectInfo) {
+	if info.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(info.RetryAfter/time.Second)))
+	}
+	if o.onReject != nil {
+		o.onReject(c, info)
+		if c.IsAborted() {
+			return
+		}
+	}
+	_ = c.Error(errBlockByPid)
+	if o.rejectBody == nil {
+		c.AbortWithStatus(o.rejectStatus)
+		return
+	}
+	var buf bytes.Buffer
+	if err := o.rejectBody.Execute(&buf, info); err != nil {
+		_ = c.Error(err)
+		c.AbortWithStatus(o.rejectStatus)
+		return
+	}
+	c.Data(o.rejectStatus, o.rejectContentType, buf.Bytes())
+	c.Abort()
+}
+
+// priority returns the tier of the request, false if the request does not carry one
+func (o *middlewareOptions) priority(c *gin.Context) (limiting.Priority, bool) {
+	if o.priorityContextKey != "" {
+		if v, ok := c.Get(o.priorityContextKey); ok {
+			switch p := v.(type) {
+			case limiting.Priority:
+				return p, true
+			case string:
+				return limiting.ParsePriority(p)
+			}
+		}
+	}
+	if o.priorityFunc != nil {
+		if p, ok := o.priorityFunc(c); ok {
+			return p, true
+		}
+	}
+	if o.priorityHeader != "" {
+		if v := c.GetHeader(o.priorityHeader); v != "" {
+			return limiting.ParsePriority(v)
+		}
+	}
+	return limiting.PriorityDefault, false
+}
+
+// WithTenantHeader enables tenant fair shedding, the tenant is read from the header
+func WithTenantHeader(header string) MiddlewareOption {
+	return WithTenantExtractor(func(c *gin.Context) string {
+		return c.GetHeader(header)
+	})
+}
+
+// WithTenantClientIP enables tenant fair shedding, every client ip is a tenant.
+// The ip is gin's c.ClientIP, which honours forwarding headers from any client unless the trusted proxies are
+// restricted with gin.Engine.SetTrustedProxies
+func WithTenantClientIP() MiddlewareOption {
+	return WithTenantExtractor(func(c *gin.Context) string {
+		return c.ClientIP()
+	})
+}
+
+// WithTenantExtractor enables tenant fair shedding with a custom tenant key. Requests with an empty key skip the fair
+// share, they are shed by the ratio of the limiter, spread across the tiers for the requests with a priority.
+// it has no effect on limiters implementing limiting.Completer, eg. BBRLimiting
+func WithTenantExtractor(f func(c *gin.Context) string) MiddlewareOption {
+	return func(options *middlewareOptions) {
+		options.tenant = f
+	}
+}
@@ -0,0 +1,308 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package adaptive
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/bytedance/pid_limits/application/adaptive/limiting/concurrency"
+	"github.com/bytedance/pid_limits/application/adaptive/route"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// tierLimit rejects every request below the critical tier and every request without a tier
+type tierLimit struct{}
+
+func (l *tierLimit) Limit() bool {
+	return true
+}
+
+func (l *tierLimit) LimitRatio() float64 {
+	return 10000
+}
+
+func (l *tierLimit) LimitWithPriority(p limiting.Priority) bool {
+	return p < limiting.PriorityCritical
+}
+
+// shadowLimit is a dry-run limiter that would reject every request
+type shadowLimit struct{ tierLimit }
+
+func (l *shadowLimit) LimitShadow() (bool, bool) {
+	return false, true
+}
+
+func (l *shadowLimit) LimitWithPriorityShadow(p limiting.Priority) (bool, bool) {
+	return false, l.LimitWithPriority(p)
+}
+
+func serve(r *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPlatoMiddlewareGinWithPriority(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if c.Query("tier") != "" {
+			c.Set("tier", c.Query("tier"))
+		}
+	})
+	r.Use(PlatoMiddlewareGinWithLimit(&tierLimit{}, WithPriorityContextKey("tier"), WithPriorityHeader(DefaultPriorityHeader)))
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	assert.Equal(t, http.StatusTooManyRequests, serve(r, httptest.NewRequest(http.MethodGet, "/", nil)).Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(DefaultPriorityHeader, "critical")
+	assert.Equal(t, http.StatusOK, serve(r, req).Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(DefaultPriorityHeader, "batch")
+	assert.Equal(t, http.StatusTooManyRequests, serve(r, req).Code)
+
+	// the context key wins over the header
+	req = httptest.NewRequest(http.MethodGet, "/?tier=3", nil)
+	req.Header.Set(DefaultPriorityHeader, "batch")
+	assert.Equal(t, http.StatusOK, serve(r, req).Code)
+}
+
+func TestPlatoMiddlewareGinPriorityHeaderOptIn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(PlatoMiddlewareGinWithLimit(&tierLimit{}))
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	// the header is not trusted unless enabled
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(DefaultPriorityHeader, "critical")
+	assert.Equal(t, http.StatusTooManyRequests, serve(r, req).Code)
+}
+
+func TestPlatoMiddlewareGinWithTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(PlatoMiddlewareGinWithLimit(&tierLimit{}, WithTenantHeader("X-Tenant")))
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	// the reject ratio is 100%, every tenant is shed whatever its share
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Tenant", "a")
+	assert.Equal(t, http.StatusTooManyRequests, serve(r, req).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(r, httptest.NewRequest(http.MethodGet, "/", nil)).Code)
+}
+
+func TestPlatoMiddlewareGinReject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(PlatoMiddlewareGinWithLimit(&tierLimit{},
+		WithRejectStatus(http.StatusServiceUnavailable),
+		WithRetryAfter(5*time.Second),
+		WithRejectJSON(`{"ratio": {{.Ratio}}}`),
+	))
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+	assert.Equal(t, `{"ratio": 10000}`, w.Body.String())
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+func TestPlatoMiddlewareGinOnReject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var got RejectInfo
+	r := gin.New()
+	r.Use(PlatoMiddlewareGinWithLimit(&tierLimit{}, WithRetryAfter(0), WithOnReject(func(c *gin.Context, info RejectInfo) {
+		got = info
+		if c.GetHeader("X-Custom") != "" {
+			c.AbortWithStatus(http.StatusTeapot)
+		}
+	})))
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "", w.Header().Get("Retry-After"))
+	assert.Equal(t, float64(10000), got.Ratio)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Custom", "1")
+	assert.Equal(t, http.StatusTeapot, serve(r, req).Code)
+}
+
+type passLimit struct{}
+
+func (l *passLimit) Limit() bool {
+	return false
+}
+
+func (l *passLimit) LimitRatio() float64 {
+	return 0
+}
+
+func TestPlatoMiddlewareGinRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(PlatoMiddlewareGinWithLimit(&tierLimit{},
+		WithExclude(route.Exact("/health"), route.Prefix("/metrics")),
+		WithRouteLimit(&passLimit{}, route.FullPath("/users/:id"), route.Glob("/static/*")),
+	))
+	ok := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+	r.GET("/health", ok)
+	r.GET("/metrics/go", ok)
+	r.GET("/users/:id", ok)
+	r.GET("/static/:file", ok)
+	r.GET("/api", ok)
+
+	for path, code := range map[string]int{
+		"/health":      http.StatusOK,
+		"/metrics/go":  http.StatusOK,
+		"/users/1":     http.StatusOK,
+		"/static/a.js": http.StatusOK,
+		"/api":         http.StatusTooManyRequests,
+	} {
+		assert.Equal(t, code, serve(r, httptest.NewRequest(http.MethodGet, path, nil)).Code, path)
+	}
+}
+
+func TestPlatoMiddlewareGinInclude(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(PlatoMiddlewareGinWithLimit(&tierLimit{}, WithInclude(route.Regex(`^/api/`))))
+	ok := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+	r.GET("/api/users", ok)
+	r.GET("/admin", ok)
+
+	assert.Equal(t, http.StatusTooManyRequests, serve(r, httptest.NewRequest(http.MethodGet, "/api/users", nil)).Code)
+	assert.Equal(t, http.StatusOK, serve(r, httptest.NewRequest(http.MethodGet, "/admin", nil)).Code)
+}
+
+func TestPlatoMiddlewareGinDryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(PlatoMiddlewareGinWithLimit(&shadowLimit{}, WithPriorityHeader(DefaultPriorityHeader)))
+	r.GET("/", func(c *gin.Context) {
+		if ShadowRejected(c) {
+			c.Status(http.StatusAccepted)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "1", w.Header().Get(DefaultDryRunHeader))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(DefaultPriorityHeader, "critical")
+	w = serve(r, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Header().Get(DefaultDryRunHeader))
+}
+
+func TestPlatoMiddlewareGinPriorityExtractor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(PlatoMiddlewareGinWithLimit(&tierLimit{}, WithPriorityExtractor(func(c *gin.Context) (limiting.Priority, bool) {
+		if c.Request.URL.Path == "/vip" {
+			return limiting.PriorityCritical, true
+		}
+		return 0, false
+	}), WithPriorityHeader(DefaultPriorityHeader)))
+	r.GET("/:path", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	assert.Equal(t, http.StatusOK, serve(r, httptest.NewRequest(http.MethodGet, "/vip", nil)).Code)
+	req := httptest.NewRequest(http.MethodGet, "/other", nil)
+	assert.Equal(t, http.StatusTooManyRequests, serve(r, req).Code)
+	req.Header.Set(DefaultPriorityHeader, "critical")
+	assert.Equal(t, http.StatusOK, serve(r, req).Code)
+}
+
+func TestConcurrencyMiddlewareGinPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := concurrency.NewAIMD(concurrency.WithInitialLimit(1))
+	r := gin.New()
+	r.Use(gin.CustomRecovery(func(c *gin.Context, _ interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	r.Use(ConcurrencyMiddlewareGin(l))
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusInternalServerError, serve(r, httptest.NewRequest(http.MethodGet, "/panic", nil)).Code)
+		assert.Equal(t, 0, l.Inflight())
+	}
+	assert.Equal(t, http.StatusOK, serve(r, httptest.NewRequest(http.MethodGet, "/", nil)).Code)
+}
+
+// completeLimit admits every request and counts the completed ones
+type completeLimit struct {
+	passLimit
+	completed int
+}
+
+func (l *completeLimit) Acquire() bool {
+	return l.Limit()
+}
+
+func (l *completeLimit) Complete(rt time.Duration) {
+	l.completed++
+}
+
+func TestPlatoMiddlewareGinCompletePanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := &completeLimit{}
+	r := gin.New()
+	r.Use(gin.CustomRecovery(func(c *gin.Context, _ interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	r.Use(PlatoMiddlewareGinWithLimit(l))
+	r.GET("/", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, serve(r, httptest.NewRequest(http.MethodGet, "/", nil)).Code)
+	assert.Equal(t, 1, l.completed)
+}
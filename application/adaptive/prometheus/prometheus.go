@@ -0,0 +1,206 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+// Package prometheus serves the limiter and entry metrics in the prometheus text exposition format,
+// without depending on the prometheus client library
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	plato "github.com/bytedance/pid_limits"
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/bytedance/pid_limits/arithmetic/pid"
+	"github.com/bytedance/pid_limits/metrics/system/cpu"
+	"github.com/bytedance/pid_limits/util/logging"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler serves the metrics of the registered limiters and of the entries passed to plato.Init
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		if err := Write(w); err != nil {
+			logging.Warn("prometheus metrics incomplete", "err", err)
+		}
+	})
+}
+
+// Write writes the metrics in the prometheus text exposition format. Prometheus rejects a scrape with duplicate series,
+// so when entries share a name only the first one is written and an error naming the others is returned after the metrics
+func Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var duplicates []string
+	for _, f := range collect() {
+		f.write(bw)
+		duplicates = append(duplicates, f.duplicates...)
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("duplicate series dropped: %s", strings.Join(duplicates, ", "))
+	}
+	return nil
+}
+
+type pidStater interface {
+	PIDState() pid.State
+}
+
+func collect() []*family {
+	var (
+		cpuUsage       = newFamily("plato_cpu_usage", "gauge", "Current cpu usage, 0 ~ 1.")
+		overloaded     = newFamily("plato_limiter_overloaded", "gauge", "Whether the cpu monitor of the limiter considers the cpu overloaded.")
+		ratio          = newFamily("plato_limiter_reject_ratio", "gauge", "Reject ratio applied to requests, 0 ~ 1.")
+		shadowRatio    = newFamily("plato_limiter_shadow_reject_ratio", "gauge", "Reject ratio a dry-run limiter would apply, 0 ~ 1.")
+		requests       = newFamily("plato_limiter_requests_total", "counter", "Requests seen by the limiter.")
+		accepted       = newFamily("plato_limiter_accepted_total", "counter", "Requests admitted by the limiter.")
+		rejected       = newFamily("plato_limiter_rejected_total", "counter", "Requests rejected by the limiter.")
+		shadowRejected = newFamily("plato_limiter_shadow_rejected_total", "counter", "Requests a dry-run limiter would have rejected.")
+		pidErr         = newFamily("plato_pid_error", "gauge", "Error of the last pid computation, set point minus cpu usage.")
+		pidIntegral    = newFamily("plato_pid_integral", "gauge", "Integral of the error of the pid controller.")
+		pidOutput      = newFamily("plato_pid_output", "gauge", "Output of the last pid computation, the negated reject rate in 0 ~ 10000.")
+		qps            = newFamily("plato_entry_qps", "gauge", "Completed requests per second of the entry.")
+		avgRT          = newFamily("plato_entry_avg_rt_milliseconds", "gauge", "Average response time of the entry.")
+		pctRT          = newFamily("plato_entry_pct_rt_milliseconds", "gauge", "90th percentile response time of the entry.")
+		errRate        = newFamily("plato_entry_error_rate", "gauge", "Share of the requests of the entry that reported an error.")
+	)
+
+	cpuUsage.add(nil, cpu.GetUsage())
+
+	for _, nl := range limiting.Limiters() {
+		labels := []string{"limiter", nl.Name}
+		if l, ok := nl.Limit.(limiting.OverloadLimit); ok {
+			overloaded.add(labels, boolValue(l.Overloaded()))
+		}
+		if l, ok := nl.Limit.(limiting.StatsLimit); ok {
+			stats := l.Stats()
+			ratio.add(labels, stats.Ratio/10000)
+			requests.add(labels, float64(stats.Requests))
+			accepted.add(labels, float64(stats.Accepted))
+			rejected.add(labels, float64(stats.Rejected))
+			if stats.DryRun {
+				shadowRatio.add(labels, stats.ShadowRatio/10000)
+				shadowRejected.add(labels, float64(stats.ShadowRejected))
+			}
+		} else {
+			ratio.add(labels, nl.Limit.LimitRatio()/10000)
+		}
+		if l, ok := nl.Limit.(pidStater); ok {
+			state := l.PIDState()
+			pidErr.add(labels, state.Err)
+			pidIntegral.add(labels, state.Integral)
+			pidOutput.add(labels, state.Output)
+		}
+	}
+
+	for _, e := range plato.Entries() {
+		labels := []string{"entry", e.Name}
+		for factory, f := range map[plato.MetricFactory]*family{plato.Qps: qps, plato.AvgRT: avgRT, plato.PctRT: pctRT, plato.ErrRate: errRate} {
+			if _, ok := e.Metrics[factory]; ok {
+				f.add(labels, plato.Chain(e, factory))
+			}
+		}
+	}
+
+	return []*family{
+		cpuUsage, overloaded, ratio, shadowRatio, requests, accepted, rejected, shadowRejected,
+		pidErr, pidIntegral, pidOutput, qps, avgRT, pctRT, errRate,
+	}
+}
+
+type family struct {
+	name, typ, help string
+	samples         []sample
+	seen            map[string]bool
+	duplicates      []string
+}
+
+type sample struct {
+	labels []string // alternating names and values
+	value  float64
+}
+
+func newFamily(name, typ, help string) *family {
+	return &family{name: name, typ: typ, help: help, seen: map[string]bool{}}
+}
+
+// add appends a sample, a sample with the labels of an earlier one is dropped and recorded as a duplicate
+func (f *family) add(labels []string, value float64) {
+	key := strings.Join(labels, "\xff")
+	if f.seen[key] {
+		f.duplicates = append(f.duplicates, f.name+"{"+strings.Join(labels, "=")+"}")
+		return
+	}
+	f.seen[key] = true
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+func (f *family) write(w *bufio.Writer) {
+	if len(f.samples) == 0 {
+		return
+	}
+	w.WriteString("# HELP " + f.name + " " + f.help + "\n")
+	w.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+	for _, s := range f.samples {
+		w.WriteString(f.name)
+		if len(s.labels) > 0 {
+			w.WriteByte('{')
+			for i := 0; i+1 < len(s.labels); i += 2 {
+				if i > 0 {
+					w.WriteByte(',')
+				}
+				w.WriteString(s.labels[i] + `="` + escapeLabel(s.labels[i+1]) + `"`)
+			}
+			w.WriteByte('}')
+		}
+		w.WriteByte(' ')
+		w.WriteString(formatValue(s.value))
+		w.WriteByte('\n')
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package prometheus
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	plato "github.com/bytedance/pid_limits"
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/bytedance/pid_limits/arithmetic/pid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLimit struct{}
+
+func (l *fakeLimit) Limit() bool {
+	return false
+}
+
+func (l *fakeLimit) LimitRatio() float64 {
+	return 2500
+}
+
+func (l *fakeLimit) Overloaded() bool {
+	return true
+}
+
+func (l *fakeLimit) Stats() limiting.Stats {
+	return limiting.Stats{DryRun: true, Ratio: 2500, ShadowRatio: 5000, Requests: 10, Accepted: 6, Rejected: 4, ShadowRejected: 3}
+}
+
+func (l *fakeLimit) PIDState() pid.State {
+	return pid.State{Err: -0.1, Integral: -12.5, Output: -2500}
+}
+
+var sampleLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{(.*)\})? (\S+)$`)
+
+// parse returns the samples keyed by name{labels}, and fails on lines not in the text exposition format
+func parse(t *testing.T, body string) map[string]float64 {
+	samples := map[string]float64{}
+	typed := map[string]bool{}
+	s := bufio.NewScanner(strings.NewReader(body))
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "# TYPE ") {
+			fields := strings.Fields(line)
+			require.Len(t, fields, 4, line)
+			typed[fields[2]] = true
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		m := sampleLine.FindStringSubmatch(line)
+		require.NotNil(t, m, line)
+		assert.True(t, typed[m[1]], "sample before its TYPE line: %s", line)
+		v, err := strconv.ParseFloat(m[4], 64)
+		require.NoError(t, err, line)
+		samples[m[1]+m[2]] = v
+	}
+	return samples
+}
+
+func TestHandler(t *testing.T) {
+	limiting.Register("test\"limiter", &fakeLimit{})
+	defer limiting.Unregister("test\"limiter")
+	e := plato.DefaultEntry("test_entry")
+	plato.Init([]*plato.PlatoEntry{e})
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+
+	samples := parse(t, w.Body.String())
+	l := `{limiter="test\"limiter"}`
+	assert.Contains(t, samples, "plato_cpu_usage")
+	assert.Equal(t, float64(1), samples["plato_limiter_overloaded"+l])
+	assert.Equal(t, 0.25, samples["plato_limiter_reject_ratio"+l])
+	assert.Equal(t, 0.5, samples["plato_limiter_shadow_reject_ratio"+l])
+	assert.Equal(t, float64(10), samples["plato_limiter_requests_total"+l])
+	assert.Equal(t, float64(6), samples["plato_limiter_accepted_total"+l])
+	assert.Equal(t, float64(4), samples["plato_limiter_rejected_total"+l])
+	assert.Equal(t, float64(3), samples["plato_limiter_shadow_rejected_total"+l])
+	assert.Equal(t, -0.1, samples["plato_pid_error"+l])
+	assert.Equal(t, -12.5, samples["plato_pid_integral"+l])
+	assert.Equal(t, float64(-2500), samples["plato_pid_output"+l])
+	for _, name := range []string{"plato_entry_qps", "plato_entry_avg_rt_milliseconds", "plato_entry_pct_rt_milliseconds", "plato_entry_error_rate"} {
+		assert.Contains(t, samples, name+`{entry="test_entry"}`)
+	}
+}
+
+func TestWriteDuplicateEntries(t *testing.T) {
+	first, second := plato.DefaultEntry("duplicate_entry"), plato.DefaultEntry("duplicate_entry")
+	plato.Init([]*plato.PlatoEntry{first, second})
+
+	var b strings.Builder
+	err := Write(&b)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `plato_entry_qps{entry=duplicate_entry}`)
+	// parse keys the samples by series, every series is written once
+	body := b.String()
+	assert.Equal(t, 1, strings.Count(body, `plato_entry_qps{entry="duplicate_entry"}`))
+	parse(t, body)
+}
+
+func TestFormatValue(t *testing.T) {
+	assert.Equal(t, "0.25", formatValue(0.25))
+	assert.Equal(t, "1e+06", formatValue(1000000))
+	assert.Equal(t, `a\\b\"c\nd`, escapeLabel("a\\b\"c\nd"))
+}
@@ -0,0 +1,427 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+// Package reload configures named limiters from a JSON or YAML file and applies the changes of the file
+// to the running limiters, the file is watched by polling its modification time
+package reload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/config"
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/bytedance/pid_limits/application/adaptive/route"
+	"github.com/bytedance/pid_limits/metrics/system/cpu"
+	"github.com/bytedance/pid_limits/util"
+	"github.com/bytedance/pid_limits/util/logging"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultInterval = 5 * time.Second
+
+// File is the content of a config file, eg.
+//
+//	limiters:
+//	  - name: http
+//	    threshold: 0.8
+//	    drift: 0.1
+//	    gains: {kp: 5351.8, ki: 12.03, kd: 0.03}
+//	    monitor: zscore
+//	    routes: ["prefix:/api/"]
+//	    priorities:
+//	      - {route: "prefix:/api/batch/", priority: batch}
+type File struct {
+	Limiters []Limiter `json:"limiters" yaml:"limiters"`
+}
+
+// Limiter configures the PIDLimiting registered under Name, Threshold is required and the other unset fields
+// keep their current value
+type Limiter struct {
+	Name      string   `json:"name" yaml:"name"`
+	Threshold float64  `json:"threshold" yaml:"threshold"`
+	Drift     *float64 `json:"drift,omitempty" yaml:"drift,omitempty"`
+	// Gains default to the gains of limiting.NewPidLimitingHttpDefault for a new limiter
+	Gains   *Gains  `json:"gains,omitempty" yaml:"gains,omitempty"`
+	Monitor string  `json:"monitor,omitempty" yaml:"monitor,omitempty"`
+	Score   float64 `json:"score,omitempty" yaml:"score,omitempty"`
+	// Routes are the route.Parse patterns of the requests the limiter applies to, see Watcher.Matcher
+	Routes []string `json:"routes,omitempty" yaml:"routes,omitempty"`
+	// Priorities give a tier to the requests of a route, the first matching rule wins, see Watcher.Priority
+	Priorities []PriorityRule `json:"priorities,omitempty" yaml:"priorities,omitempty"`
+}
+
+type Gains struct {
+	Kp float64 `json:"kp" yaml:"kp"`
+	Ki float64 `json:"ki" yaml:"ki"`
+	Kd float64 `json:"kd" yaml:"kd"`
+}
+
+type PriorityRule struct {
+	Route    string `json:"route" yaml:"route"`
+	Priority string `json:"priority" yaml:"priority"`
+}
+
+// Parse decodes a config file, format is "json" or "yaml", unknown fields are errors
+func Parse(data []byte, format string) (*File, error) {
+	var f File
+	switch format {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&f); err != nil {
+			return nil, fmt.Errorf("reload: decode json: %w", err)
+		}
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&f); err != nil {
+			return nil, fmt.Errorf("reload: decode yaml: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("reload: unknown format %q", format)
+	}
+	return &f, nil
+}
+
+// Load reads and decodes a config file, the format is guessed from the extension: .json, .yaml or .yml
+func Load(path string) (*File, error) {
+	format, err := formatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reload: %w", err)
+	}
+	return Parse(data, format)
+}
+
+func formatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json", nil
+	case ".yaml", ".yml":
+		return "yaml", nil
+	}
+	return "", fmt.Errorf("reload: unknown config file extension of %q, expect .json, .yaml or .yml", path)
+}
+
+// compiled is a validated File
+type compiled struct {
+	file     File
+	limiters map[string]*compiledLimiter
+}
+
+type compiledLimiter struct {
+	config     Limiter
+	opts       []config.OptionFunc
+	routes     route.Matcher
+	priorities []compiledPriority
+}
+
+type compiledPriority struct {
+	matcher  route.Matcher
+	priority limiting.Priority
+}
+
+// compile validates every limiter of f, a File is applied as a whole or not at all
+func compile(f *File) (*compiled, error) {
+	c := &compiled{file: *f, limiters: make(map[string]*compiledLimiter, len(f.Limiters))}
+	for i, l := range f.Limiters {
+		if l.Name == "" {
+			return nil, fmt.Errorf("reload: limiters[%d]: name is required", i)
+		}
+		if _, ok := c.limiters[l.Name]; ok {
+			return nil, fmt.Errorf("reload: limiter %q: duplicated name", l.Name)
+		}
+		cl, err := compileLimiter(l)
+		if err != nil {
+			return nil, fmt.Errorf("reload: limiter %q: %w", l.Name, err)
+		}
+		c.limiters[l.Name] = cl
+	}
+	return c, nil
+}
+
+func compileLimiter(l Limiter) (*compiledLimiter, error) {
+	cl := &compiledLimiter{config: l, opts: []config.OptionFunc{config.WithThreshold(l.Threshold)}}
+	if l.Drift != nil {
+		cl.opts = append(cl.opts, config.WithDrift(*l.Drift))
+	}
+	if l.Gains != nil {
+		cl.opts = append(cl.opts, config.WithGains(l.Gains.Kp, l.Gains.Ki, l.Gains.Kd))
+	}
+	if l.Monitor != "" {
+		alg, err := cpu.ParseMonitorAlg(l.Monitor)
+		if err != nil {
+			return nil, err
+		}
+		cl.opts = append(cl.opts, config.WithMonitorAlg(alg))
+	}
+	if l.Score != 0 {
+		cl.opts = append(cl.opts, config.WithScore(l.Score))
+	}
+	option := config.NewOptions()
+	for _, opt := range cl.opts {
+		opt(option)
+	}
+	if err := option.Validate(); err != nil {
+		return nil, err
+	}
+
+	var matchers []route.Matcher
+	for _, pattern := range l.Routes {
+		m, err := route.Parse(pattern)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	if len(matchers) > 0 {
+		cl.routes = route.Any(matchers...)
+	}
+	for _, rule := range l.Priorities {
+		m, err := route.Parse(rule.Route)
+		if err != nil {
+			return nil, err
+		}
+		p, ok := limiting.ParsePriority(rule.Priority)
+		if !ok {
+			return nil, fmt.Errorf("unknown priority %q of route %q", rule.Priority, rule.Route)
+		}
+		cl.priorities = append(cl.priorities, compiledPriority{matcher: m, priority: p})
+	}
+	return cl, nil
+}
+
+type Option func(*Watcher)
+
+// WithInterval sets how often the modification time of the file is checked, 5s by default
+func WithInterval(interval time.Duration) Option {
+	return func(w *Watcher) {
+		w.interval = interval
+	}
+}
+
+// WithLimiterOptions sets the options of the limiters created by the watcher, the file takes precedence
+func WithLimiterOptions(opts ...config.OptionFunc) Option {
+	return func(w *Watcher) {
+		w.limiterOpts = opts
+	}
+}
+
+// Watcher applies a config file to the limiters it names. A limiter already registered under a name, eg. built
+// with config.WithName, is updated, other limiters are created. An invalid file is rejected as a whole and the last
+// good config is kept
+type Watcher struct {
+	path        string
+	interval    time.Duration
+	limiterOpts []config.OptionFunc
+
+	mu       sync.Mutex // serializes the reloads
+	modTime  time.Time
+	size     int64
+	limiters map[string]*limiting.PIDLimiting
+	current  atomic.Value // *compiled
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+}
+
+// NewWatcher loads the file and applies it, the file is only watched after Start
+func NewWatcher(path string, opts ...Option) (*Watcher, error) {
+	w := &Watcher{
+		path:     path,
+		interval: defaultInterval,
+		limiters: map[string]*limiting.PIDLimiting{},
+		stop:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Start polls the file in background
+func (w *Watcher) Start() {
+	w.startOnce.Do(func() {
+		go util.LoopWithIntervalUntil(func() {
+			_ = w.Reload()
+		}, w.interval, w.stop)
+	})
+}
+
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+// Reload applies the file if its modification time or size changed since the last attempt
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	info, err := os.Stat(w.path)
+	if err != nil {
+		logging.Error("stat config file failed", "path", w.path, "err", err)
+		return fmt.Errorf("reload: %w", err)
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return nil
+	}
+	if err := w.load(); err != nil {
+		logging.Error("config file rejected, the last good config is kept", "path", w.path, "err", err)
+		return err
+	}
+	return nil
+}
+
+// load reads, validates and applies the file, the caller holds mu
+func (w *Watcher) load() error {
+	if info, err := os.Stat(w.path); err == nil {
+		// remember the attempt so a bad file is only reported once
+		w.modTime, w.size = info.ModTime(), info.Size()
+	}
+	f, err := Load(w.path)
+	if err != nil {
+		return err
+	}
+	c, err := compile(f)
+	if err != nil {
+		return err
+	}
+	// every limiter is checked against its live options before any of them changes
+	for _, l := range f.Limiters {
+		if err := w.check(c.limiters[l.Name]); err != nil {
+			return fmt.Errorf("reload: limiter %q: %w", l.Name, err)
+		}
+	}
+	var errs []string
+	for _, l := range f.Limiters {
+		if err := w.apply(c.limiters[l.Name]); err != nil {
+			errs = append(errs, fmt.Sprintf("limiter %q: %v", l.Name, err))
+		}
+	}
+	w.current.Store(c)
+	if len(errs) > 0 {
+		// only an update racing the watcher fails here, the rest of the file is applied
+		return fmt.Errorf("reload: %s", strings.Join(errs, "; "))
+	}
+	logging.Info("config file applied", "path", w.path, "limiters", len(f.Limiters))
+	return nil
+}
+
+// check validates the limiter against the options it would be updated or created with
+func (w *Watcher) check(cl *compiledLimiter) error {
+	if l := w.limiter(cl.config.Name); l != nil {
+		return l.CheckUpdate(cl.opts...)
+	}
+	option := config.NewOptions()
+	for _, opt := range w.limiterOpts {
+		opt(option)
+	}
+	for _, opt := range cl.opts {
+		opt(option)
+	}
+	return option.Validate()
+}
+
+// apply updates the limiter, a new limiter is created first so the file takes precedence over the code and the environment
+func (w *Watcher) apply(cl *compiledLimiter) error {
+	name := cl.config.Name
+	if l := w.limiter(name); l != nil {
+		return l.Update(cl.opts...)
+	}
+	opts := append(append([]config.OptionFunc(nil), w.limiterOpts...), config.WithName(name))
+	var l *limiting.PIDLimiting
+	if g := cl.config.Gains; g != nil {
+		l = limiting.NewPidLimiting(g.Kp, g.Ki, g.Kd, cl.config.Threshold, opts...)
+	} else {
+		l = limiting.NewPidLimitingHttpDefault(cl.config.Threshold, opts...).(*limiting.PIDLimiting)
+	}
+	w.limiters[name] = l
+	return l.Update(cl.opts...)
+}
+
+func (w *Watcher) limiter(name string) *limiting.PIDLimiting {
+	if l, ok := w.limiters[name]; ok {
+		return l
+	}
+	if l, ok := limiting.Lookup(name); ok {
+		if pl, ok := l.(*limiting.PIDLimiting); ok {
+			w.limiters[name] = pl
+			return pl
+		}
+	}
+	return nil
+}
+
+// Limiter returns the limiter configured under name, nil if the file never named it
+func (w *Watcher) Limiter(name string) *limiting.PIDLimiting {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.limiters[name]
+}
+
+// Config returns the last good config
+func (w *Watcher) Config() File {
+	return w.compiled().file
+}
+
+func (w *Watcher) compiled() *compiled {
+	c, _ := w.current.Load().(*compiled)
+	if c == nil {
+		return &compiled{}
+	}
+	return c
+}
+
+// Matcher matches the requests of the routes of the limiter, following the reloads of the file.
+// It can be passed to the WithRouteLimit option of the middlewares
+func (w *Watcher) Matcher(name string) route.Matcher {
+	return route.MatcherFunc(func(path, fullPath string) bool {
+		cl := w.compiled().limiters[name]
+		return cl != nil && cl.routes != nil && cl.routes.Match(path, fullPath)
+	})
+}
+
+// Priority returns the tier the priorities of the limiter give to a request, following the reloads of the file.
+// It can back the WithPriorityExtractor option of the middlewares
+func (w *Watcher) Priority(name, path, fullPath string) (limiting.Priority, bool) {
+	cl := w.compiled().limiters[name]
+	if cl == nil {
+		return limiting.PriorityDefault, false
+	}
+	for _, rule := range cl.priorities {
+		if rule.matcher.Match(path, fullPath) {
+			return rule.priority, true
+		}
+	}
+	return limiting.PriorityDefault, false
+}
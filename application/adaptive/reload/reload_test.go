@@ -0,0 +1,187 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package reload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bytedance/pid_limits/application/adaptive/config"
+	"github.com/bytedance/pid_limits/application/adaptive/limiting"
+	"github.com/bytedance/pid_limits/metrics/system/cpu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const goodYAML = `
+limiters:
+  - name: reload-api
+    threshold: 0.8
+    drift: 0.05
+    gains: {kp: 1, ki: 2, kd: 3}
+    monitor: raw
+    routes: ["prefix:/api/"]
+    priorities:
+      - {route: "prefix:/api/batch/", priority: batch}
+      - {route: "/api/pay", priority: critical}
+`
+
+// write replaces the file and moves its modification time forward, the polling does not depend on the clock resolution
+func write(t *testing.T, path, content string, at time.Time) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	require.NoError(t, os.Chtimes(path, at, at))
+}
+
+func TestWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plato.yaml")
+	now := time.Now()
+	write(t, path, goodYAML, now)
+	w, err := NewWatcher(path, WithLimiterOptions(config.WithDisableMetric(), config.WithRecorder(0)))
+	require.NoError(t, err)
+	defer limiting.Unregister("reload-api")
+
+	l := w.Limiter("reload-api")
+	require.NotNil(t, l)
+	s := l.Snapshot()
+	assert.Equal(t, []float64{1, 2, 3, 0.8}, []float64{s.Kp, s.Ki, s.Kd, s.SetPoint})
+	assert.Equal(t, cpu.Raw, s.Monitor.Alg)
+	assert.InDelta(t, 0.85, s.Monitor.UpperThreshold, 1e-9)
+
+	m := w.Matcher("reload-api")
+	assert.True(t, m.Match("/api/users", ""))
+	assert.False(t, m.Match("/health", ""))
+	p, ok := w.Priority("reload-api", "/api/batch/export", "")
+	assert.True(t, ok)
+	assert.Equal(t, limiting.PriorityBatch, p)
+	p, ok = w.Priority("reload-api", "/api/pay", "")
+	assert.True(t, ok)
+	assert.Equal(t, limiting.PriorityCritical, p)
+	_, ok = w.Priority("reload-api", "/api/users", "")
+	assert.False(t, ok)
+
+	// unchanged file
+	assert.NoError(t, w.Reload())
+
+	write(t, path, `
+limiters:
+  - name: reload-api
+    threshold: 0.6
+    routes: ["/health"]
+`, now.Add(time.Second))
+	require.NoError(t, w.Reload())
+	s = l.Snapshot()
+	assert.Equal(t, []float64{1, 2, 3, 0.6}, []float64{s.Kp, s.Ki, s.Kd, s.SetPoint})
+	assert.True(t, m.Match("/health", ""))
+	assert.False(t, m.Match("/api/users", ""))
+	assert.Same(t, l, w.Limiter("reload-api"))
+
+	write(t, path, `
+limiters:
+  - name: reload-api
+    threshold: 1.5
+`, now.Add(2*time.Second))
+	err = w.Reload()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `limiter "reload-api"`)
+	assert.Contains(t, err.Error(), "Threshold")
+	assert.Equal(t, 0.6, l.Snapshot().SetPoint)
+	assert.Equal(t, 0.6, w.Config().Limiters[0].Threshold)
+	// a rejected file is not retried until it changes
+	assert.NoError(t, w.Reload())
+}
+
+func TestWatcherUpdatesRegisteredLimiter(t *testing.T) {
+	l := limiting.NewPidLimiting(1, 1, 1, 0.8, config.WithName("reload-existing"), config.WithDisableMetric(), config.WithRecorder(0))
+	defer limiting.Unregister("reload-existing")
+	path := filepath.Join(t.TempDir(), "plato.json")
+	write(t, path, `{"limiters": [{"name": "reload-existing", "threshold": 0.7, "gains": {"kp": 4, "ki": 5, "kd": 6}}]}`, time.Now())
+
+	w, err := NewWatcher(path)
+	require.NoError(t, err)
+	assert.Same(t, l, w.Limiter("reload-existing"))
+	s := l.Snapshot()
+	assert.Equal(t, []float64{4, 5, 6, 0.7}, []float64{s.Kp, s.Ki, s.Kd, s.SetPoint})
+}
+
+func TestWatcherAppliesNothingOnError(t *testing.T) {
+	l := limiting.NewPidLimiting(1, 1, 1, 0.8, config.WithName("reload-atomic"), config.WithDisableMetric(), config.WithRecorder(0))
+	defer limiting.Unregister("reload-atomic")
+	// a limiter not built by NewPidLimiting can not be updated
+	limiting.Register("reload-atomic-fixed", &limiting.PIDLimiting{})
+	defer limiting.Unregister("reload-atomic-fixed")
+	path := filepath.Join(t.TempDir(), "plato.yaml")
+	write(t, path, `
+limiters:
+  - name: reload-atomic
+    threshold: 0.7
+  - name: reload-atomic-new
+    threshold: 0.7
+  - name: reload-atomic-fixed
+    threshold: 0.7
+`, time.Now())
+
+	_, err := NewWatcher(path, WithLimiterOptions(config.WithDisableMetric(), config.WithRecorder(0)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `limiter "reload-atomic-fixed"`)
+	assert.Equal(t, 0.8, l.Snapshot().SetPoint)
+	_, ok := limiting.Lookup("reload-atomic-new")
+	assert.False(t, ok)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		format, data, want string
+	}{
+		{"yaml", "limiters:\n  - name: a\n    treshold: 0.8\n", "field treshold not found"},
+		{"json", `{"limiters": [{"name": "a", "treshold": 0.8}]}`, `unknown field "treshold"`},
+		{"toml", "", "unknown format"},
+	} {
+		_, err := Parse([]byte(tc.data), tc.format)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), tc.want)
+	}
+
+	for _, tc := range []struct {
+		file File
+		want string
+	}{
+		{File{Limiters: []Limiter{{Threshold: 0.8}}}, "name is required"},
+		{File{Limiters: []Limiter{{Name: "a", Threshold: 0.8}, {Name: "a", Threshold: 0.8}}}, "duplicated name"},
+		{File{Limiters: []Limiter{{Name: "a", Threshold: 0.8, Monitor: "ewma?"}}}, "unknown monitor alg"},
+		{File{Limiters: []Limiter{{Name: "a", Threshold: 0.8, Routes: []string{"regex:("}}}}, "bad regex"},
+		{File{Limiters: []Limiter{{Name: "a", Threshold: 0.8, Priorities: []PriorityRule{{Route: "/x", Priority: "vip"}}}}}, "unknown priority"},
+	} {
+		_, err := compile(&tc.file)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), tc.want)
+	}
+
+	_, err := NewWatcher(filepath.Join(t.TempDir(), "plato.ini"))
+	assert.Error(t, err)
+}
+
+func TestWatcherOverridesEnv(t *testing.T) {
+	t.Setenv(config.EnvThreshold, "0.6")
+	path := filepath.Join(t.TempDir(), "plato.yaml")
+	write(t, path, goodYAML, time.Now())
+	w, err := NewWatcher(path, WithLimiterOptions(config.WithDisableMetric(), config.WithRecorder(0)))
+	require.NoError(t, err)
+	defer limiting.Unregister("reload-api")
+
+	assert.Equal(t, 0.8, w.Limiter("reload-api").Snapshot().SetPoint)
+}
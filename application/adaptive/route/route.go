@@ -0,0 +1,145 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+// Package route matches requests by their path, it is shared by the gin and the net/http middlewares
+// to exempt routes from shedding or to give routes their own limiter
+package route
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Matcher matches a request by its path, fullPath is the registered route pattern, eg. "/users/:id" of gin,
+// it is empty when the framework does not provide one
+type Matcher interface {
+	Match(path, fullPath string) bool
+}
+
+type MatcherFunc func(path, fullPath string) bool
+
+func (f MatcherFunc) Match(path, fullPath string) bool {
+	return f(path, fullPath)
+}
+
+// Exact matches the request path exactly
+func Exact(p string) Matcher {
+	return MatcherFunc(func(reqPath, _ string) bool {
+		return reqPath == p
+	})
+}
+
+// Prefix matches request paths starting with prefix
+func Prefix(prefix string) Matcher {
+	return MatcherFunc(func(reqPath, _ string) bool {
+		return strings.HasPrefix(reqPath, prefix)
+	})
+}
+
+// Glob matches the request path by a shell pattern, see path.Match, eg. "/api/*/health".
+// it panics if the pattern is malformed
+func Glob(pattern string) Matcher {
+	if _, err := path.Match(pattern, ""); err != nil {
+		panic("route: bad glob pattern " + pattern + ": " + err.Error())
+	}
+	return MatcherFunc(func(reqPath, _ string) bool {
+		ok, _ := path.Match(pattern, reqPath)
+		return ok
+	})
+}
+
+// Regex matches the request path by a regular expression, it panics if expr cannot be compiled
+func Regex(expr string) Matcher {
+	re := regexp.MustCompile(expr)
+	return MatcherFunc(func(reqPath, _ string) bool {
+		return re.MatchString(reqPath)
+	})
+}
+
+// FullPath matches the registered route pattern, eg. FullPath("/users/:id")
+func FullPath(pattern string) Matcher {
+	return MatcherFunc(func(_, fullPath string) bool {
+		return fullPath != "" && fullPath == pattern
+	})
+}
+
+// Any matches if one of the matchers does
+func Any(matchers ...Matcher) Matcher {
+	return MatcherFunc(func(reqPath, fullPath string) bool {
+		for _, m := range matchers {
+			if m.Match(reqPath, fullPath) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Parse builds a matcher from its text form, as used in config files:
+// "exact:/health", "prefix:/api/", "glob:/users/*", "regex:^/v[12]/", "full:/users/:id".
+// Without a scheme, a pattern containing one of *?[ is a glob and any other pattern is exact
+func Parse(pattern string) (Matcher, error) {
+	scheme, value := "", pattern
+	if i := strings.Index(pattern, ":"); i > 0 && !strings.HasPrefix(pattern, "/") {
+		scheme, value = pattern[:i], pattern[i+1:]
+	}
+	if value == "" {
+		return nil, fmt.Errorf("route: empty pattern %q", pattern)
+	}
+	if scheme == "" {
+		scheme = "exact"
+		if strings.ContainsAny(value, "*?[") {
+			scheme = "glob"
+		}
+	}
+	switch scheme {
+	case "exact":
+		return Exact(value), nil
+	case "prefix":
+		return Prefix(value), nil
+	case "glob":
+		if _, err := path.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("route: bad glob pattern %q: %v", value, err)
+		}
+		return Glob(value), nil
+	case "regex":
+		if _, err := regexp.Compile(value); err != nil {
+			return nil, fmt.Errorf("route: bad regex %q: %v", value, err)
+		}
+		return Regex(value), nil
+	case "full":
+		return FullPath(value), nil
+	}
+	return nil, fmt.Errorf("route: unknown scheme %q in pattern %q", scheme, pattern)
+}
+
+// Filter decides whether a request is subject to shedding, with include matchers only the matching requests are,
+// exclude matchers always win
+type Filter struct {
+	Include []Matcher
+	Exclude []Matcher
+}
+
+func (f *Filter) Limited(reqPath, fullPath string) bool {
+	if len(f.Exclude) > 0 && Any(f.Exclude...).Match(reqPath, fullPath) {
+		return false
+	}
+	if len(f.Include) > 0 {
+		return Any(f.Include...).Match(reqPath, fullPath)
+	}
+	return true
+}
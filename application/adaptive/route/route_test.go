@@ -0,0 +1,73 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package route
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchers(t *testing.T) {
+	assert.True(t, Exact("/health").Match("/health", ""))
+	assert.False(t, Exact("/health").Match("/health/db", ""))
+	assert.True(t, Prefix("/admin/").Match("/admin/users", ""))
+	assert.True(t, Glob("/api/*/health").Match("/api/v1/health", ""))
+	assert.False(t, Glob("/api/*/health").Match("/api/v1/x/health", ""))
+	assert.True(t, Regex(`^/api/v\d+/`).Match("/api/v2/users", ""))
+	assert.True(t, FullPath("/users/:id").Match("/users/1", "/users/:id"))
+	assert.False(t, FullPath("/users/:id").Match("/users/1", ""))
+	assert.Panics(t, func() { Glob("[") })
+}
+
+func TestFilter(t *testing.T) {
+	f := &Filter{}
+	assert.True(t, f.Limited("/any", ""))
+
+	f = &Filter{Exclude: []Matcher{Exact("/health"), Prefix("/metrics")}}
+	assert.False(t, f.Limited("/health", ""))
+	assert.False(t, f.Limited("/metrics/go", ""))
+	assert.True(t, f.Limited("/api", ""))
+
+	f = &Filter{Include: []Matcher{Prefix("/api")}, Exclude: []Matcher{Exact("/api/health")}}
+	assert.True(t, f.Limited("/api/users", ""))
+	assert.False(t, f.Limited("/api/health", ""))
+	assert.False(t, f.Limited("/static", ""))
+}
+
+func TestParse(t *testing.T) {
+	for pattern, want := range map[string][2]string{
+		"/health":        {"/health", "/healthz"},
+		"exact:/health":  {"/health", "/healthz"},
+		"prefix:/api/":   {"/api/users", "/apiv2"},
+		"/users/*":       {"/users/1", "/users/1/orders"},
+		"glob:/users/*":  {"/users/1", "/users"},
+		`regex:^/v[12]/`: {"/v1/users", "/v3/users"},
+	} {
+		m, err := Parse(pattern)
+		assert.NoError(t, err, pattern)
+		assert.True(t, m.Match(want[0], ""), pattern)
+		assert.False(t, m.Match(want[1], ""), pattern)
+	}
+	m, err := Parse("full:/users/:id")
+	assert.NoError(t, err)
+	assert.True(t, m.Match("/users/1", "/users/:id"))
+
+	for _, pattern := range []string{"", "exact:", "glob:[", "regex:(", "wild:/x"} {
+		_, err := Parse(pattern)
+		assert.Error(t, err, pattern)
+	}
+}
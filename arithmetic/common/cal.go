@@ -44,3 +44,16 @@ func StandardDeviation(x []float64, avg float64) float64 {
 	sd := math.Sqrt(variance / float64(len(x)))
 	return sd
 }
+
+// EWMA is the exponentially weighted moving average of x in order of time, alpha is the weight of the latest value.
+// The average starts from the first value, 0 for an empty x
+func EWMA(x []float64, alpha float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	avg := x[0]
+	for _, v := range x[1:] {
+		avg = alpha*v + (1-alpha)*avg
+	}
+	return avg
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// Histogram counts values into fixed buckets. Bucket i counts the values above bounds[i-1] up to bounds[i], one more
+// bucket counts the values above every bound. Add, Count and Counts are safe for concurrent use
+type Histogram struct {
+	bounds []float64
+	counts []uint64
+}
+
+// NewHistogram returns a histogram of the upper bounds of the buckets, in ascending order
+func NewHistogram(bounds ...float64) (*Histogram, error) {
+	if len(bounds) == 0 {
+		return nil, fmt.Errorf("common: histogram needs at least one bound")
+	}
+	for i, b := range bounds {
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			return nil, fmt.Errorf("common: histogram bound %v is not finite", b)
+		}
+		if i > 0 && b <= bounds[i-1] {
+			return nil, fmt.Errorf("common: histogram bounds should ascend, got %v after %v", b, bounds[i-1])
+		}
+	}
+	return &Histogram{
+		bounds: append([]float64(nil), bounds...),
+		counts: make([]uint64, len(bounds)+1),
+	}, nil
+}
+
+// LinearBuckets is count bounds from start, width apart
+func LinearBuckets(start, width float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start + float64(i)*width
+	}
+	return bounds
+}
+
+// ExponentialBuckets is count bounds from start, each factor times the last
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start * math.Pow(factor, float64(i))
+	}
+	return bounds
+}
+
+// Add counts v in its bucket, NaN is dropped
+func (h *Histogram) Add(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	atomic.AddUint64(&h.counts[sort.SearchFloat64s(h.bounds, v)], 1)
+}
+
+// Bounds are the upper bounds of the buckets
+func (h *Histogram) Bounds() []float64 {
+	return append([]float64(nil), h.bounds...)
+}
+
+// Counts are the counts of the buckets, the last is of the values above every bound
+func (h *Histogram) Counts() []uint64 {
+	counts := make([]uint64, len(h.counts))
+	for i := range h.counts {
+		counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	return counts
+}
+
+// Count is how many values were added
+func (h *Histogram) Count() uint64 {
+	var count uint64
+	for i := range h.counts {
+		count += atomic.LoadUint64(&h.counts[i])
+	}
+	return count
+}
+
+// Quantile estimates the p, 0 ~ 1, quantile by interpolating within its bucket. The first bucket starts from 0, or
+// from its bound when that is negative, and the values above every bound are taken as the last bound
+func (h *Histogram) Quantile(p float64) float64 {
+	counts := h.Counts()
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	_, rank := percentileRank(int(total), p)
+	var seen uint64
+	for i, c := range counts {
+		if c == 0 || seen+c <= uint64(rank) {
+			seen += c
+			continue
+		}
+		if i == len(h.bounds) {
+			return h.bounds[len(h.bounds)-1]
+		}
+		lower := math.Min(0, h.bounds[0])
+		if i > 0 {
+			lower = h.bounds[i-1]
+		}
+		return lower + (h.bounds[i]-lower)*float64(uint64(rank)-seen+1)/float64(c)
+	}
+	return h.bounds[len(h.bounds)-1]
+}
+
+// Reset zeroes every bucket
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		atomic.StoreUint64(&h.counts[i], 0)
+	}
+}
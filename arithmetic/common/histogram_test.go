@@ -0,0 +1,48 @@
+package common
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	for _, bounds := range [][]float64{nil, {1, 1}, {2, 1}, {math.NaN()}, {math.Inf(1)}} {
+		if _, err := NewHistogram(bounds...); err == nil {
+			t.Errorf("NewHistogram(%v) should fail", bounds)
+		}
+	}
+
+	h, err := NewHistogram(LinearBuckets(10, 10, 10)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := h.Quantile(0.5); got != 0 {
+		t.Errorf("Quantile() of nothing = %v, want 0", got)
+	}
+	for v := 1; v <= 100; v++ {
+		h.Add(float64(v))
+	}
+	h.Add(500)
+	h.Add(math.NaN())
+	if h.Count() != 101 {
+		t.Errorf("Count() = %d, want 101", h.Count())
+	}
+	want := []uint64{10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 1}
+	if got := h.Counts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Counts() = %v, want %v", got, want)
+	}
+	for p, want := range map[float64]float64{0: 1, 0.5: 51, 0.9: 91, 0.99: 100, 1: 100} {
+		if got := h.Quantile(p); math.Abs(got-want) > 1e-9 {
+			t.Errorf("Quantile(%v) = %v, want %v", p, got, want)
+		}
+	}
+	h.Reset()
+	if h.Count() != 0 {
+		t.Errorf("Count() after Reset = %d, want 0", h.Count())
+	}
+
+	if got, want := ExponentialBuckets(1, 2, 4), []float64{1, 2, 4, 8}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ExponentialBuckets() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+package common
+
+import (
+	"math"
+	"sort"
+)
+
+// MADScale scales the median absolute deviation to the standard deviation of normally distributed values
+const MADScale = 1.4826
+
+// Percentile is the p, 0 ~ 1, percentile of x interpolated between the closest ranks, 0 for an empty x. x is left as
+// is, SelectPercentile does the same without the sorted copy
+func Percentile(x []float64, p float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), x...)
+	sort.Float64s(sorted)
+	rank, lower := percentileRank(len(sorted), p)
+	if lower >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (rank-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+// SelectPercentile is Percentile by quickselect, it reorders x and allocates nothing
+func SelectPercentile(x []float64, p float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	rank, lower := percentileRank(len(x), p)
+	v := Select(x, lower)
+	if lower >= len(x)-1 || rank == float64(lower) {
+		return v
+	}
+	// Select leaves the values above the lower rank after it, the next rank is the least of them
+	next := x[lower+1]
+	for _, u := range x[lower+2:] {
+		if u < next {
+			next = u
+		}
+	}
+	return v + (rank-float64(lower))*(next-v)
+}
+
+func percentileRank(n int, p float64) (float64, int) {
+	if p < 0 {
+		p = 0
+	} else if p > 1 {
+		p = 1
+	}
+	rank := p * float64(n-1)
+	return rank, int(math.Floor(rank))
+}
+
+// Select is the k-th, from 0, least value of x. It reorders x so that the values before k are not above it and the
+// values after k are not below it, and allocates nothing. It panics when k is out of range
+func Select(x []float64, k int) float64 {
+	if k < 0 || k >= len(x) {
+		panic("common: select out of range")
+	}
+	lo, hi := 0, len(x)-1
+	for lo < hi {
+		lt, gt := partition(x, lo, hi)
+		switch {
+		case k < lt:
+			hi = lt - 1
+		case k > gt:
+			lo = gt + 1
+		default:
+			return x[k]
+		}
+	}
+	return x[k]
+}
+
+// partition splits x[lo:hi+1] around the median of its first, middle and last values into the values below it, the
+// values equal to it at lt ~ gt, and the values above it, so that equal values do not make Select quadratic
+func partition(x []float64, lo, hi int) (lt, gt int) {
+	a, b, c := x[lo], x[lo+(hi-lo)/2], x[hi]
+	pivot := math.Max(math.Min(a, b), math.Min(math.Max(a, b), c))
+	lt, gt = lo, hi
+	for i := lo; i <= gt; {
+		switch {
+		case x[i] < pivot:
+			x[i], x[lt] = x[lt], x[i]
+			lt++
+			i++
+		case x[i] > pivot:
+			x[i], x[gt] = x[gt], x[i]
+			gt--
+		default:
+			i++
+		}
+	}
+	return lt, gt
+}
+
+// Median is the median of x, 0 for an empty x
+func Median(x []float64) float64 {
+	return Percentile(x, 0.5)
+}
+
+// MAD is the median of x and the median absolute deviation from it, unscaled
+func MAD(x []float64) (median, mad float64) {
+	if len(x) == 0 {
+		return 0, 0
+	}
+	median = Median(x)
+	deviations := make([]float64, len(x))
+	for i, v := range x {
+		deviations[i] = math.Abs(v - median)
+	}
+	return median, SelectPercentile(deviations, 0.5)
+}
+
+// MADFilter drops the values whose robust z-score, their distance to the median in median absolute deviations scaled
+// by MADScale, is above score. x is returned as is when the deviation is 0, eg. for equal values
+func MADFilter(x []float64, score float64) []float64 {
+	median, mad := MAD(x)
+	mad *= MADScale
+	if mad == 0 {
+		return x
+	}
+	kept := make([]float64, 0, len(x))
+	for _, v := range x {
+		if math.Abs(v-median)/mad <= score {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
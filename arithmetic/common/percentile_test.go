@@ -0,0 +1,99 @@
+package common
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name string
+		x    []float64
+		p    float64
+		want float64
+	}{
+		{"empty", nil, 0.5, 0},
+		{"single", []float64{7}, 0.9, 7},
+		{"median", []float64{4, 1, 3, 2}, 0.5, 2.5},
+		{"p90", []float64{4, 1, 3, 2}, 0.9, 3.7},
+		{"max", []float64{4, 1, 3, 2}, 1, 4},
+		{"min", []float64{4, 1, 3, 2}, 0, 1},
+		{"above one", []float64{4, 1, 3, 2}, 1.5, 4},
+		{"p90 of ten", []float64{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}, 0.9, 9.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x := append([]float64(nil), tt.x...)
+			if got := Percentile(x, tt.p); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Percentile() = %v, want %v", got, tt.want)
+			}
+			for i := range x {
+				if x[i] != tt.x[i] {
+					t.Fatalf("Percentile() reordered x to %v", x)
+				}
+			}
+			if got := SelectPercentile(x, tt.p); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("SelectPercentile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 1; n < 200; n += 7 {
+		x := make([]float64, n)
+		for i := range x {
+			// few distinct values so that equal values are partitioned too
+			x[i] = float64(rnd.Intn(5))
+		}
+		sorted := append([]float64(nil), x...)
+		sort.Float64s(sorted)
+		for _, k := range []int{0, n / 2, n - 1} {
+			if got := Select(x, k); got != sorted[k] {
+				t.Fatalf("Select(%d) of %d = %v, want %v", k, n, got, sorted[k])
+			}
+			for i := range x {
+				if (i < k && x[i] > x[k]) || (i > k && x[i] < x[k]) {
+					t.Fatalf("Select(%d) left %v at %d around %v", k, x[i], i, x[k])
+				}
+			}
+		}
+		p := rnd.Float64()
+		if got, want := SelectPercentile(x, p), Percentile(sorted, p); math.Abs(got-want) > 1e-9 {
+			t.Errorf("SelectPercentile(%v) = %v, want %v", p, got, want)
+		}
+	}
+
+	x := make([]float64, 100)
+	if allocs := testing.AllocsPerRun(100, func() { SelectPercentile(x, 0.9) }); allocs != 0 {
+		t.Errorf("SelectPercentile() allocates %v times, want 0", allocs)
+	}
+}
+
+func TestMAD(t *testing.T) {
+	median, mad := MAD([]float64{1, 1, 2, 2, 4, 6, 9})
+	if median != 2 || mad != 1 {
+		t.Errorf("MAD() = %v, %v, want 2, 1", median, mad)
+	}
+	if got := Median([]float64{3, 1, 2}); got != 2 {
+		t.Errorf("Median() = %v, want 2", got)
+	}
+	if got := MADFilter([]float64{1, 1.1, 0.9, 1, 5}, 3); len(got) != 4 || got[3] != 1 {
+		t.Errorf("MADFilter() = %v, want the outlier dropped", got)
+	}
+	if got := MADFilter([]float64{1, 1, 1}, 3); len(got) != 3 {
+		t.Errorf("MADFilter() of equal values = %v, want every value", got)
+	}
+}
+
+func TestEWMA(t *testing.T) {
+	if got := EWMA([]float64{0.5, 1}, 0.5); got != 0.75 {
+		t.Errorf("EWMA() = %v, want 0.75", got)
+	}
+	if got := EWMA(nil, 0.5); got != 0 {
+		t.Errorf("EWMA() of nothing = %v, want 0", got)
+	}
+}
@@ -0,0 +1,158 @@
+package common
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// sketchMinValue is the least value a DDSketch tells apart from 0
+	sketchMinValue = 1e-9
+	// sketchMaxBins bounds the memory of a DDSketch, the lowest bins are collapsed beyond it
+	sketchMaxBins = 2048
+)
+
+// DDSketch estimates quantiles of a stream of non-negative values in bounded memory, every estimate is within the
+// relative accuracy of a value of the stream of that rank. Values are counted in bins of logarithmic width, the
+// values below 1e-9, and the negative ones, are taken as 0. DDSketch is not safe for concurrent use
+type DDSketch struct {
+	accuracy float64
+	gamma    float64
+	logGamma float64
+	// bins[i] counts the values of the index offset+i
+	bins   []uint64
+	offset int
+	zeros  uint64
+	count  uint64
+	min    float64
+	max    float64
+}
+
+// NewDDSketch returns a sketch of the relative accuracy, 0 ~ 1 exclusive, eg. 0.01 for 1%
+func NewDDSketch(relativeAccuracy float64) (*DDSketch, error) {
+	if !(relativeAccuracy > 0 && relativeAccuracy < 1) {
+		return nil, fmt.Errorf("common: sketch relative accuracy should be in (0, 1), got %v", relativeAccuracy)
+	}
+	gamma := (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	return &DDSketch{accuracy: relativeAccuracy, gamma: gamma, logGamma: math.Log(gamma)}, nil
+}
+
+// RelativeAccuracy is the relative accuracy the sketch was created with
+func (s *DDSketch) RelativeAccuracy() float64 {
+	return s.accuracy
+}
+
+// Add counts v, NaN is dropped
+func (s *DDSketch) Add(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	if v < 0 {
+		v = 0
+	}
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.count++
+	if v < sketchMinValue {
+		s.zeros++
+		return
+	}
+	s.addIndex(s.index(v), 1)
+}
+
+func (s *DDSketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+// value is the estimate of the values of the index, the relative accuracy away from either end of its bin
+func (s *DDSketch) value(index int) float64 {
+	return 2 * math.Pow(s.gamma, float64(index)) / (s.gamma + 1)
+}
+
+func (s *DDSketch) addIndex(index int, count uint64) {
+	if len(s.bins) == 0 {
+		s.bins = append(s.bins, 0)
+		s.offset = index
+	}
+	if index < s.offset {
+		grow := s.offset - index
+		if len(s.bins)+grow > sketchMaxBins {
+			// the lowest values lose their accuracy first
+			grow = sketchMaxBins - len(s.bins)
+		}
+		if grow > 0 {
+			s.bins = append(make([]uint64, grow, grow+len(s.bins)), s.bins...)
+			s.offset -= grow
+		}
+		if index < s.offset {
+			index = s.offset
+		}
+	}
+	if last := s.offset + len(s.bins) - 1; index > last {
+		s.bins = append(s.bins, make([]uint64, index-last)...)
+		if extra := len(s.bins) - sketchMaxBins; extra > 0 {
+			for _, c := range s.bins[:extra] {
+				s.bins[extra] += c
+			}
+			s.bins = append(s.bins[:0], s.bins[extra:]...)
+			s.offset += extra
+		}
+	}
+	s.bins[index-s.offset] += count
+}
+
+// Count is how many values were added
+func (s *DDSketch) Count() uint64 {
+	return s.count
+}
+
+// Quantile estimates the p, 0 ~ 1, quantile, 0 for an empty sketch
+func (s *DDSketch) Quantile(p float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	_, rank := percentileRank(int(s.count), p)
+	seen := s.zeros
+	if uint64(rank) < seen {
+		return s.min
+	}
+	for i, c := range s.bins {
+		if seen += c; uint64(rank) < seen {
+			return math.Min(math.Max(s.value(s.offset+i), s.min), s.max)
+		}
+	}
+	return s.max
+}
+
+// Merge adds the values of o, which should have the same relative accuracy
+func (s *DDSketch) Merge(o *DDSketch) error {
+	if o.gamma != s.gamma {
+		return fmt.Errorf("common: cannot merge a sketch of relative accuracy %v into %v", o.accuracy, s.accuracy)
+	}
+	if o.count == 0 {
+		return nil
+	}
+	if s.count == 0 || o.min < s.min {
+		s.min = o.min
+	}
+	if s.count == 0 || o.max > s.max {
+		s.max = o.max
+	}
+	s.count += o.count
+	s.zeros += o.zeros
+	for i, c := range o.bins {
+		if c > 0 {
+			s.addIndex(o.offset+i, c)
+		}
+	}
+	return nil
+}
+
+// Reset drops every value
+func (s *DDSketch) Reset() {
+	*s = DDSketch{accuracy: s.accuracy, gamma: s.gamma, logGamma: s.logGamma, bins: s.bins[:0]}
+}
@@ -0,0 +1,87 @@
+package common
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestDDSketch(t *testing.T) {
+	for _, accuracy := range []float64{0, 1, -0.1, math.NaN()} {
+		if _, err := NewDDSketch(accuracy); err == nil {
+			t.Errorf("NewDDSketch(%v) should fail", accuracy)
+		}
+	}
+
+	s, _ := NewDDSketch(0.01)
+	if got := s.Quantile(0.5); got != 0 {
+		t.Errorf("Quantile() of nothing = %v, want 0", got)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	values := make([]float64, 0, 10000)
+	for i := 0; i < 10000; i++ {
+		v := math.Exp(rnd.NormFloat64() * 2)
+		if i%100 == 0 {
+			v = 0
+		}
+		values = append(values, v)
+		s.Add(v)
+	}
+	s.Add(math.NaN())
+	if s.Count() != 10000 {
+		t.Errorf("Count() = %d, want 10000", s.Count())
+	}
+	sort.Float64s(values)
+	check := func(s *DDSketch, values []float64) {
+		for _, p := range []float64{0, 0.005, 0.1, 0.5, 0.9, 0.99, 0.999, 1} {
+			want := values[int(p*float64(len(values)-1))]
+			if got := s.Quantile(p); math.Abs(got-want) > s.RelativeAccuracy()*want+1e-12 {
+				t.Errorf("Quantile(%v) = %v, want %v within 1%%", p, got, want)
+			}
+		}
+	}
+	check(s, values)
+
+	o, _ := NewDDSketch(0.01)
+	more := make([]float64, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		v := 1000 + rnd.Float64()*1000
+		more = append(more, v)
+		o.Add(v)
+	}
+	if err := s.Merge(o); err != nil {
+		t.Fatal(err)
+	}
+	values = append(values, more...)
+	sort.Float64s(values)
+	check(s, values)
+
+	other, _ := NewDDSketch(0.05)
+	if err := s.Merge(other); err == nil {
+		t.Error("Merge() of another accuracy should fail")
+	}
+	s.Reset()
+	if s.Count() != 0 || s.Quantile(0.5) != 0 {
+		t.Errorf("Reset() left %d values", s.Count())
+	}
+}
+
+func TestDDSketchMaxBins(t *testing.T) {
+	s, _ := NewDDSketch(0.001)
+	var last float64
+	for v := 1e-8; v < 1e8; v *= 1.001 {
+		s.Add(v)
+		last = v
+	}
+	if len(s.bins) > sketchMaxBins {
+		t.Errorf("the sketch kept %d bins, want at most %d", len(s.bins), sketchMaxBins)
+	}
+	// the highest values keep their accuracy
+	if got := s.Quantile(1); math.Abs(got-last) > last*0.001 {
+		t.Errorf("Quantile(1) = %v, want %v within 0.1%%", got, last)
+	}
+	if got := s.Quantile(0.99); got < 1e7 {
+		t.Errorf("Quantile(0.99) = %v, want above 1e7", got)
+	}
+}
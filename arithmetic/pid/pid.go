@@ -15,7 +15,12 @@
  */
 package pid
 
-import "github.com/bytedance/pid_limits/util"
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/bytedance/pid_limits/util"
+)
 
 const (
 	OUTMAX = 0
@@ -23,6 +28,7 @@ const (
 )
 
 type PID struct {
+	mu          sync.Mutex
 	kp, ki, kd  float64
 	setPoint    float64
 	getSetPoint func() float64
@@ -31,6 +37,18 @@ type PID struct {
 	lastTime    uint64
 	outMax      float64
 	outMin      float64
+	state       atomic.Value
+}
+
+// State is the snapshot of the last Compute, P, I and D are the terms summed into the output before clamping
+type State struct {
+	SetPoint   float64
+	Input      float64
+	Err        float64
+	Integral   float64
+	Derivative float64
+	P, I, D    float64
+	Output     float64
 }
 
 type Option struct {
@@ -74,10 +92,29 @@ func SetTunings(kp, ki, kd, setPoint float64, opts ...OptionFunc) *PID {
 	return pid
 }
 
+func (pid *PID) Tunings() (kp, ki, kd float64) {
+	pid.mu.Lock()
+	defer pid.mu.Unlock()
+	return pid.kp, pid.ki, pid.kd
+}
+
+// SetGains replaces the gains of a running controller, the integral and the last error are kept
+func (pid *PID) SetGains(kp, ki, kd float64) {
+	pid.mu.Lock()
+	defer pid.mu.Unlock()
+	pid.kp, pid.ki, pid.kd = kp, ki, kd
+}
+
 func (pid *PID) GetThreshold() float64 {
 	return pid.getSetPoint()
 }
 
+// State returns the snapshot of the last Compute, it is safe to call concurrently with Compute
+func (pid *PID) State() State {
+	s, _ := pid.state.Load().(State)
+	return s
+}
+
 func (pid *PID) setOutLimit(max, min float64) {
 	if max < min {
 		return
@@ -91,24 +128,36 @@ func (pid *PID) setOutLimit(max, min float64) {
 }
 
 func (pid *PID) Compute(input float64) float64 {
+	// the dynamic set point may publish events whose subscribers read the tunings, it is read before locking
+	setPoint := pid.getSetPoint()
+	pid.mu.Lock()
+	defer pid.mu.Unlock()
 
 	now := util.CurrentTimeMillis()
 	timeChange := now - pid.lastTime
-	err := pid.getSetPoint() - input
+	err := setPoint - input
 	old := pid.errSum
 	pid.errSum = pid.errSum + err*(float64(timeChange))
-	dErr := (err - pid.lastErr) / float64(timeChange)
+	var dErr float64
+	// a second Compute within the same millisecond has no derivative
+	if timeChange != 0 {
+		dErr = (err - pid.lastErr) / float64(timeChange)
+	}
 
 	pid.lastErr = err
 	pid.lastTime = now
-	out := pid.kp*err + pid.ki*pid.errSum + pid.kd*dErr
+	p, i, d := pid.kp*err, pid.ki*pid.errSum, pid.kd*dErr
+	out := p + i + d
 	if out > pid.outMax {
 		pid.errSum = old
-		return pid.outMax
+		out = pid.outMax
 	} else if out < pid.outMin {
 		pid.errSum = old
-		return pid.outMin
-	} else {
-		return out
+		out = pid.outMin
 	}
+	pid.state.Store(State{
+		SetPoint: setPoint, Input: input, Err: err, Integral: pid.errSum, Derivative: dErr,
+		P: p, I: i, D: d, Output: out,
+	})
+	return out
 }
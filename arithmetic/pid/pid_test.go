@@ -18,6 +18,7 @@ package  pid
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestSetTunings(t *testing.T) {
@@ -248,3 +249,34 @@ func TestPID_Compute(t *testing.T) {
 		})
 	}
 }
+
+func TestPID_State(t *testing.T) {
+	pid := SetTunings(1, 0, 0, 0.5)
+	if got := pid.State(); got != (State{}) {
+		t.Errorf("PID.State() = %v, want zero before Compute", got)
+	}
+	out := pid.Compute(0.8)
+	got := pid.State()
+	if got.Input != 0.8 || got.SetPoint != 0.5 || got.Output != out || got.P != got.Err || got.I != 0 {
+		t.Errorf("PID.State() = %+v, output %v", got, out)
+	}
+}
+
+func TestPID_ComputeDynamicPointReadsTunings(t *testing.T) {
+	var pid *PID
+	pid = SetTunings(1, 0, 0, 0.5, WithDynamicPoint(func() float64 {
+		// a set point publishing events whose subscribers read the tunings must not deadlock
+		pid.Tunings()
+		return 0.5
+	}))
+	done := make(chan struct{})
+	go func() {
+		pid.Compute(0.8)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("PID.Compute() deadlocked reading the set point")
+	}
+}
@@ -16,10 +16,10 @@
 package pid
 
 import (
-	"log"
 	"math"
 
 	"github.com/bytedance/pid_limits/util"
+	"github.com/bytedance/pid_limits/util/logging"
 )
 
 const (
@@ -121,7 +121,7 @@ func (t *Tuner) TunePID(input float64) float64 {
 
 		// Increment cycle count
 		t.i += 1
-		log.Printf("pidtuner: %v", t.i)
+		logging.Debug("pid tuner cycle", "cycle", t.i)
 	}
 
 	// If loop is done, disable output and calculate averages
@@ -131,7 +131,7 @@ func (t *Tuner) TunePID(input float64) float64 {
 		t.kp = t.pAverage / (float64(t.i) - 1)
 		t.ki = t.iAverage / (float64(t.i) - 1)
 		t.kd = t.dAverage / (float64(t.i) - 1)
-		log.Printf("end = %v %v %v", t.kp, t.ki, t.kd)
+		logging.Info("pid tuner done", "kp", t.kp, "ki", t.ki, "kd", t.kd)
 	}
 
 	return t.outputValue
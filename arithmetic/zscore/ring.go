@@ -0,0 +1,133 @@
+package zscore
+
+import "math"
+
+// flat is the standard deviation, relative to the mean, below which the values are taken as not deviating at all, so
+// the rounding error of the mean of equal values is not scored
+const flat = 1e-12
+
+// Ring keeps the last size values with their mean and variance updated in O(1) by Welford's method, so the z-score
+// of a value is known without a pass over the window. Add allocates nothing. Ring is not safe for concurrent use
+type Ring struct {
+	values []float64
+	next   int
+	count  int
+	mean   float64
+	// m2 is the sum of the squared deviations from the mean
+	m2 float64
+	// replaced counts the values overwritten since the last resync
+	replaced int
+}
+
+// NewRing returns a ring of size values, size less than 1 is taken as 1
+func NewRing(size int) *Ring {
+	if size < 1 {
+		size = 1
+	}
+	return &Ring{values: make([]float64, size)}
+}
+
+// Add records v, overwriting the oldest value once the ring is full
+func (r *Ring) Add(v float64) {
+	if r.count < len(r.values) {
+		r.values[r.next] = v
+		r.next = (r.next + 1) % len(r.values)
+		r.count++
+		delta := v - r.mean
+		r.mean += delta / float64(r.count)
+		r.m2 += delta * (v - r.mean)
+		return
+	}
+	old := r.values[r.next]
+	r.values[r.next] = v
+	r.next = (r.next + 1) % len(r.values)
+	mean := r.mean + (v-old)/float64(r.count)
+	r.m2 += (v - old) * (v - mean + old - r.mean)
+	r.mean = mean
+	if r.m2 < 0 {
+		r.m2 = 0
+	}
+	// the sliding update accumulates rounding error, recompute once per lap to keep it bounded
+	if r.replaced++; r.replaced >= len(r.values) {
+		r.resync()
+	}
+}
+
+func (r *Ring) resync() {
+	r.replaced = 0
+	var sum float64
+	for _, v := range r.values[:r.count] {
+		sum += v
+	}
+	r.mean = sum / float64(r.count)
+	r.m2 = 0
+	for _, v := range r.values[:r.count] {
+		r.m2 += (v - r.mean) * (v - r.mean)
+	}
+}
+
+// Reset drops every value
+func (r *Ring) Reset() {
+	*r = Ring{values: r.values}
+}
+
+// Len is the number of values in the ring
+func (r *Ring) Len() int {
+	return r.count
+}
+
+// Mean is the mean of the values, 0 when the ring is empty
+func (r *Ring) Mean() float64 {
+	return r.mean
+}
+
+// StdDev is the population standard deviation of the values, the same as common.StandardDeviation
+func (r *Ring) StdDev() float64 {
+	if r.count == 0 {
+		return 0
+	}
+	return math.Sqrt(r.m2 / float64(r.count))
+}
+
+// Score is the z-score of v against the values. When the values do not deviate at all, v scores 0 if it equals the
+// mean and +Inf or -Inf otherwise, instead of the NaN of dividing by a zero standard deviation
+func (r *Ring) Score(v float64) float64 {
+	sd := r.StdDev()
+	if tolerance := flat * math.Max(1, math.Abs(r.mean)); sd <= tolerance {
+		switch {
+		case v-r.mean > tolerance:
+			return math.Inf(1)
+		case r.mean-v > tolerance:
+			return math.Inf(-1)
+		}
+		return 0
+	}
+	return (v - r.mean) / sd
+}
+
+// Values appends the values in order of time to dst
+func (r *Ring) Values(dst []float64) []float64 {
+	start := r.next - r.count
+	if start < 0 {
+		start += len(r.values)
+	}
+	for i := 0; i < r.count; i++ {
+		dst = append(dst, r.values[(start+i)%len(r.values)])
+	}
+	return dst
+}
+
+// Filter appends the values whose absolute z-score is less than score to dst in order of time, pass dst[:0] of a
+// reused slice to filter without allocating. Every value is kept when the values do not deviate at all
+func (r *Ring) Filter(dst []float64, score float64) []float64 {
+	start := r.next - r.count
+	if start < 0 {
+		start += len(r.values)
+	}
+	for i := 0; i < r.count; i++ {
+		if v := r.values[(start+i)%len(r.values)]; math.Abs(r.Score(v)) < score {
+			dst = append(dst, v)
+		}
+	}
+	return dst
+}
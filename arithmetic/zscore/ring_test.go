@@ -0,0 +1,78 @@
+package zscore
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/bytedance/pid_limits/arithmetic/common"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(5)
+	rnd := rand.New(rand.NewSource(1))
+	var all []float64
+	for i := 0; i < 1000; i++ {
+		v := rnd.Float64()
+		if i%97 == 0 {
+			v += 5
+		}
+		r.Add(v)
+		all = append(all, v)
+		window := all[len(all)-r.Len():]
+		if got := r.Values(nil); !reflect.DeepEqual(got, window) {
+			t.Fatalf("Values() = %v, want %v", got, window)
+		}
+		u := common.AverageFloat(window)
+		if math.Abs(r.Mean()-u) > 1e-9 || math.Abs(r.StdDev()-common.StandardDeviation(window, u)) > 1e-9 {
+			t.Fatalf("Mean(), StdDev() = %v, %v, want %v, %v", r.Mean(), r.StdDev(), u, common.StandardDeviation(window, u))
+		}
+		if got, want := r.Filter(nil, 1.5), ZScore(window, 1.5); len(got) != len(want) {
+			t.Fatalf("Filter() = %v, want %v", got, want)
+		}
+	}
+	if r.Len() != 5 {
+		t.Errorf("Len() = %d, want 5", r.Len())
+	}
+	r.Reset()
+	if r.Len() != 0 || r.Mean() != 0 || r.StdDev() != 0 {
+		t.Errorf("Reset() left %d values, mean %v, sd %v", r.Len(), r.Mean(), r.StdDev())
+	}
+}
+
+func TestRingFlat(t *testing.T) {
+	r := NewRing(60)
+	for _, v := range []float64{0.1, 0.2} {
+		r.Add(v)
+	}
+	for i := 0; i < 60; i++ {
+		r.Add(0.3)
+	}
+	if got := r.Filter(nil, 2.4); len(got) != 60 {
+		t.Errorf("Filter() of a flat window kept %d values, want 60", len(got))
+	}
+	if got := r.Score(0.3); got != 0 {
+		t.Errorf("Score(0.3) = %v, want 0", got)
+	}
+	if got := r.Score(0.4); !math.IsInf(got, 1) {
+		t.Errorf("Score(0.4) = %v, want +Inf", got)
+	}
+	if got := ZScore([]float64{0.3, 0.3, 0.3}, 2.4); len(got) != 3 {
+		t.Errorf("ZScore() of a flat window = %v, want every value", got)
+	}
+}
+
+func TestRingAllocs(t *testing.T) {
+	r := NewRing(60)
+	buf := make([]float64, 0, 60)
+	v := 0.0
+	allocs := testing.AllocsPerRun(1000, func() {
+		v += 0.01
+		r.Add(math.Mod(v, 1))
+		buf = r.Filter(buf[:0], 2.4)
+	})
+	if allocs != 0 {
+		t.Errorf("Add and Filter allocate %v times per run, want 0", allocs)
+	}
+}
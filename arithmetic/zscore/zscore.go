@@ -20,11 +20,15 @@ import (
 	"math"
 )
 
-// use z-score to eliminate the abnormal value
+// use z-score to eliminate the abnormal value, Ring does the same on a stream without a pass over the window
 func ZScore(record []float64, score float64) (windows []float64) {
 	u := common.AverageFloat(record)
 	sd := common.StandardDeviation(record, u)
 	windows = make([]float64, 0)
+	if sd == 0 {
+		// no value deviates from the mean, none of them is abnormal
+		return append(windows, record...)
+	}
 	count := 0
 	var total float64 = 0
 	for _, v := range record {
@@ -28,6 +28,7 @@ import (
 type metricsConainer interface {
 	AddMetrics(...*Metric) int
 	NextMetric() *Metric
+	Len() int
 }
 
 func NewCalculateManager(workersCount int, queueSize int) (*CalculateManager, error) {
@@ -52,6 +53,11 @@ func (c *CalculateManager) AddMetrics(metrics ...*Metric) int {
 	return c.mc.AddMetrics(metrics...)
 }
 
+//MetricCount returns the number of metrics calculated in background
+func (c *CalculateManager) MetricCount() int {
+	return c.mc.Len()
+}
+
 func (c *CalculateManager) Start() {
 	c.initOnce.Do(func() {
 		go func() {
@@ -93,6 +99,10 @@ func (c *CopyOnWriteMetricsContainer) NextMetric() *Metric {
 	return metrics[int(idx%base)]
 }
 
+func (c *CopyOnWriteMetricsContainer) Len() int {
+	return len(c.l.Load().([]*Metric))
+}
+
 func (c *CopyOnWriteMetricsContainer) AddMetrics(ms ...*Metric) int {
 	if len(ms) == 0 {
 		return 0
@@ -56,3 +56,11 @@ func TestCalculateManager(t *testing.T) {
 	assert.True(t, Chain(entry, Qps) > 0)
 	assert.True(t, Chain(entry, ErrRate) > 0)
 }
+
+func TestCalculateManager_MetricCount(t *testing.T) {
+	mc, _ := NewCalculateManager(1, 10)
+	entry := DefaultEntry("test_metric_count")
+	assert.Equal(t, 0, mc.MetricCount())
+	mc.AddMetrics(entry.Metrics[Qps], entry.Metrics[AvgRT], entry.Metrics[Qps])
+	assert.Equal(t, 2, mc.MetricCount())
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+type Type int
+
+const (
+	// OverloadStarted is published when a limiter starts shedding
+	OverloadStarted Type = iota
+	// OverloadEnded is published when a limiter stops shedding
+	OverloadEnded
+	// RatioChanged is published when the reject ratio moved by more than the configured step since the last event
+	RatioChanged
+	// CollectorError is published when collecting the cpu usage starts failing, once per run of failures
+	CollectorError
+	// InvalidSetPoint is published when the set point of a limiter turns invalid and is clamped
+	InvalidSetPoint
+)
+
+func (t Type) String() string {
+	switch t {
+	case OverloadStarted:
+		return "overload_started"
+	case OverloadEnded:
+		return "overload_ended"
+	case RatioChanged:
+		return "ratio_changed"
+	case CollectorError:
+		return "collector_error"
+	case InvalidSetPoint:
+		return "invalid_set_point"
+	}
+	return "unknown"
+}
+
+// Event is a decision or failure of a limiter or a collector, the ratios are in 0 ~ 10000
+type Event struct {
+	Type      Type
+	Source    string
+	Time      time.Time
+	CPUUsage  float64
+	Ratio     float64
+	PrevRatio float64
+	Err       error
+}
+
+type Handler func(e Event)
+
+// Bus delivers events to its subscribers synchronously, handlers should return quickly
+type Bus struct {
+	mu       sync.RWMutex
+	next     int
+	handlers []subscriber
+}
+
+type subscriber struct {
+	id int
+	h  Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers h, the returned func removes it
+func (b *Bus) Subscribe(h Handler) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	// copy on write, Publish iterates a snapshot without holding the lock
+	b.handlers = append(b.handlers[:len(b.handlers):len(b.handlers)], subscriber{id: id, h: h})
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		handlers := make([]subscriber, 0, len(b.handlers))
+		for _, s := range b.handlers {
+			if s.id != id {
+				handlers = append(handlers, s)
+			}
+		}
+		b.handlers = handlers
+	}
+}
+
+// Publish delivers e to the subscribers in subscription order
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+	for _, s := range handlers {
+		s.h(e)
+	}
+}
+
+var defaultBus = NewBus()
+
+// Subscribe registers h on the global bus, it receives the events of every limiter and collector
+func Subscribe(h Handler) (unsubscribe func()) {
+	return defaultBus.Subscribe(h)
+}
+
+// Publish delivers e to the subscribers of the global bus
+func Publish(e Event) {
+	defaultBus.Publish(e)
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package event
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus(t *testing.T) {
+	b := NewBus()
+	var got []string
+	unsubscribe := b.Subscribe(func(e Event) {
+		got = append(got, "a:"+e.Type.String())
+	})
+	b.Subscribe(func(e Event) {
+		assert.False(t, e.Time.IsZero())
+		got = append(got, "b:"+e.Type.String())
+	})
+
+	b.Publish(Event{Type: OverloadStarted})
+	unsubscribe()
+	b.Publish(Event{Type: OverloadEnded})
+	assert.Equal(t, []string{"a:overload_started", "b:overload_started", "b:overload_ended"}, got)
+}
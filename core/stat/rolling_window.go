@@ -0,0 +1,92 @@
+package stat
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket 是滚动窗口中的一个时间桶
+type Bucket struct {
+	Sum   int64 // 桶内数据点的和
+	Count int64 // 桶内数据点的个数
+}
+
+// RollingWindow 是按时间分桶的滚动窗口，只保存每个桶的聚合值，内存占用固定
+type RollingWindow struct {
+	buckets        []Bucket
+	bucketDuration int64 // 每个桶的时间跨度，单位为毫秒
+	offset         int   // 当前桶的下标
+	lastTime       int64 // 当前桶的起始时间，单位为毫秒
+	mutex          sync.RWMutex
+	now            func() time.Time
+}
+
+// NewRollingWindow 创建一个有 size 个桶、每个桶跨度为 bucketDuration 的滚动窗口
+func NewRollingWindow(size int, bucketDuration time.Duration) *RollingWindow {
+	return NewRollingWindowWithClock(size, bucketDuration, time.Now)
+}
+
+// NewRollingWindowWithClock 创建一个使用指定时钟的滚动窗口，便于测试
+func NewRollingWindowWithClock(size int, bucketDuration time.Duration, now func() time.Time) *RollingWindow {
+	if size <= 0 {
+		size = 1
+	}
+	duration := int64(bucketDuration / time.Millisecond)
+	if duration <= 0 {
+		duration = 1
+	}
+	rw := &RollingWindow{
+		buckets:        make([]Bucket, size),
+		bucketDuration: duration,
+		now:            now,
+	}
+	rw.lastTime = rw.align(rw.now().UnixMilli())
+	return rw
+}
+
+// Add 向当前桶中添加一个数据点
+func (rw *RollingWindow) Add(value int64) {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	rw.roll()
+	rw.buckets[rw.offset].Sum += value
+	rw.buckets[rw.offset].Count++
+}
+
+// Reduce 按时间顺序遍历除当前桶以外的所有桶，当前桶的数据还不完整，不参与统计
+func (rw *RollingWindow) Reduce(fn func(b Bucket)) {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	rw.roll()
+	size := len(rw.buckets)
+	for i := 1; i < size; i++ {
+		fn(rw.buckets[(rw.offset+i)%size])
+	}
+}
+
+// BucketDuration 返回每个桶的时间跨度
+func (rw *RollingWindow) BucketDuration() time.Duration {
+	return time.Duration(rw.bucketDuration) * time.Millisecond
+}
+
+// roll 根据当前时间移动到新的桶，并清空过期的桶
+func (rw *RollingWindow) roll() {
+	now := rw.align(rw.now().UnixMilli())
+	span := int((now - rw.lastTime) / rw.bucketDuration)
+	if span <= 0 {
+		return
+	}
+	size := len(rw.buckets)
+	if span > size {
+		span = size
+	}
+	for i := 0; i < span; i++ {
+		rw.offset = (rw.offset + 1) % size
+		rw.buckets[rw.offset] = Bucket{}
+	}
+	rw.lastTime = now
+}
+
+func (rw *RollingWindow) align(ms int64) int64 {
+	return ms - ms%rw.bucketDuration
+}
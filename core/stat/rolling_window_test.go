@@ -0,0 +1,43 @@
+package stat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollingWindow(t *testing.T) {
+	now := time.UnixMilli(1000000)
+	rw := NewRollingWindowWithClock(3, 100*time.Millisecond, func() time.Time { return now })
+
+	rw.Add(1)
+	rw.Add(2)
+	sum := func() (s, c int64) {
+		rw.Reduce(func(b Bucket) {
+			s += b.Sum
+			c += b.Count
+		})
+		return
+	}
+	// the current bucket is not reduced
+	s, c := sum()
+	assert.Equal(t, int64(0), s)
+	assert.Equal(t, int64(0), c)
+
+	now = now.Add(100 * time.Millisecond)
+	rw.Add(10)
+	s, c = sum()
+	assert.Equal(t, int64(3), s)
+	assert.Equal(t, int64(2), c)
+
+	now = now.Add(200 * time.Millisecond)
+	s, _ = sum()
+	assert.Equal(t, int64(10), s)
+
+	// all buckets expired
+	now = now.Add(time.Second)
+	s, c = sum()
+	assert.Equal(t, int64(0), s)
+	assert.Equal(t, int64(0), c)
+}
@@ -18,16 +18,27 @@ type SlidingWindow struct {
 	currSum    int          // 当前窗口数据点的和
 	mutex      sync.RWMutex
 	expireTime int64 // 数据点过期时间，单位为毫秒
+	now        func() time.Time
 }
 
 // NewSlidingWindow 创建一个新的滑动窗口.
 // size < 0 意味着数据可以无限存储，慎用，容易导致 oom
 // size = 0 意味着不会存储原始数据，无法使用 pct 等统计功能
 func NewSlidingWindow(size int, expireTime time.Duration) *SlidingWindow {
+	return NewSlidingWindowWithClock(size, expireTime, time.Now)
+}
+
+// NewSlidingWindowWithClock 创建一个使用指定时钟的滑动窗口，便于测试
+func NewSlidingWindowWithClock(size int, expireTime time.Duration, now func() time.Time) *SlidingWindow {
+	capacity := size
+	if capacity < 0 {
+		capacity = 0
+	}
 	return &SlidingWindow{
-		data:       make([]*DataPoint, 0, size),
+		data:       make([]*DataPoint, 0, capacity),
 		size:       size,
 		expireTime: int64(expireTime / time.Millisecond),
+		now:        now,
 	}
 }
 
@@ -37,7 +48,7 @@ func (sw *SlidingWindow) Add(value int) int {
 	defer sw.mutex.Unlock()
 
 	dataPoint := &DataPoint{
-		Timestamp: time.Now().UnixMilli(),
+		Timestamp: sw.now().UnixMilli(),
 		Value:     value,
 	}
 	// 移除过期的数据点
@@ -50,7 +61,7 @@ func (sw *SlidingWindow) Add(value int) int {
 	sw.currSum += dataPoint.Value
 
 	// 如果数据点数量超过窗口大小，则移除最旧的数据点
-	if len(sw.data) > sw.size {
+	if sw.size >= 0 && len(sw.data) > sw.size {
 		oldestData := sw.data[0]
 		sw.currSum -= oldestData.Value
 		sw.data = sw.data[1:]
@@ -80,7 +91,26 @@ func (sw *SlidingWindow) GetData() []int {
 	return record
 }
 
+// GetDataPoints 获取滑动窗口中未过期的数据点及其时间戳，不会修改窗口
+func (sw *SlidingWindow) GetDataPoints() []DataPoint {
+	sw.mutex.RLock()
+	defer sw.mutex.RUnlock()
+	currTime := sw.now().UnixMilli()
+	var points []DataPoint
+	for _, d := range sw.data {
+		if currTime-d.Timestamp > sw.expireTime {
+			continue
+		}
+		points = append(points, *d)
+	}
+	return points
+}
+
+// GetSum 获取滑动窗口中未过期数据点的和
 func (sw *SlidingWindow) GetSum() int {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	sw.removeExpiredDataPoints()
 	return sw.currSum
 }
 
@@ -97,7 +127,7 @@ func (sw *SlidingWindow) GetIncreaseRatio() float64 {
 
 // removeExpiredDataPoints 移除过期的数据点
 func (sw *SlidingWindow) removeExpiredDataPoints() {
-	currTime := time.Now().UnixNano() / int64(time.Millisecond)
+	currTime := sw.now().UnixMilli()
 
 	for len(sw.data) > 0 {
 		oldestData := sw.data[0]
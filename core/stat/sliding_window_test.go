@@ -28,3 +28,21 @@ func TestNewSlidingWindow(t *testing.T) {
 
 	fmt.Println("Current sum:", window.currSum) // 输出当前窗口数据点的和
 }
+
+func TestSlidingWindowGetDataPoints(t *testing.T) {
+	now := time.Unix(100, 0)
+	window := NewSlidingWindowWithClock(10, time.Second, func() time.Time { return now })
+	window.Add(10)
+	now = now.Add(600 * time.Millisecond)
+	window.Add(20)
+	now = now.Add(600 * time.Millisecond)
+
+	points := window.GetDataPoints()
+	if len(points) != 1 || points[0].Value != 20 || points[0].Timestamp != 100600 {
+		t.Fatalf("expected the unexpired point only, got %v", points)
+	}
+	// 读取不会移除过期的数据点
+	if len(window.data) != 2 {
+		t.Fatalf("expected the window to be left unchanged, got %d points", len(window.data))
+	}
+}
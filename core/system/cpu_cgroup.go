@@ -16,14 +16,16 @@
 package  system
 
 import (
+	"fmt"
 	"io/ioutil"
-	"log"
 	"math"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/bytedance/pid_limits/util/logging"
 )
 
 const (
@@ -66,7 +68,7 @@ func extractSystemPath(line string) string {
 func getPodSystemPath() string {
 	data, err := ioutil.ReadFile(cGroupPath)
 	if err != nil {
-		log.Printf("error: read /proc/self/cgroup error: %v\n", err)
+		logging.Error("read /proc/self/cgroup failed", "err", err)
 		return notRetrievedPath
 	}
 	return extractSystemPath(string(data))
@@ -74,18 +76,26 @@ func getPodSystemPath() string {
 
 // use bufio to read file should be better than ioutil
 func getDockerSystemMetric(filepath string) int64 {
-	data, err := ioutil.ReadFile(filepath)
+	value, err := readDockerSystemMetric(filepath)
 	if err != nil {
-		log.Printf("error: fetch file from path %v error: %v\n", filepath, err)
+		logging.Error("read cgroup file failed", "path", filepath, "err", err)
 		return 0
 	}
-	var value int64
+	return value
+}
+
+// readDockerSystemMetric is getDockerSystemMetric for the collector, the failure is returned instead of logged
+func readDockerSystemMetric(filepath string) (int64, error) {
+	data, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return 0, err
+	}
 	line := strings.ReplaceAll(string(data), "\n", "")
-	if value, err = strconv.ParseInt(line, 10, 64); err != nil {
-		log.Printf("error: parse cpu usage file error %v\n", err)
-		return 0
+	value, err := strconv.ParseInt(line, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", filepath, err)
 	}
-	return value
+	return value, nil
 }
 
 func initCGroup() bool {
@@ -118,10 +128,12 @@ func fileExist(filename string) bool {
 }
 
 func getCPURateByCGroup() (rate float64, err error) {
-	usage := getDockerSystemMetric(dockerCPUUsagePath)
+	usage, err := readDockerSystemMetric(dockerCPUUsagePath)
+	if err != nil {
+		return retrieveValueFailed, err
+	}
 	if usage == prevCGroupStat.cpuUsage {
-		// 打日志
-		log.Println("error: retrieveValueFailed")
+		logging.Debug("cpu usage not changed", "path", dockerCPUUsagePath)
 		return retrieveValueFailed, retrieveValueError
 	}
 	now := time.Now().UnixNano()
@@ -19,12 +19,13 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"math"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/bytedance/pid_limits/util/logging"
 )
 
 const (
@@ -56,7 +57,7 @@ func extractSystemPathByCGroupV2(line string) string {
 func getPodSystemPathByCGroupV2() string {
 	data, err := ioutil.ReadFile(cGroupV2Path)
 	if err != nil {
-		log.Printf("read /proc/1/cgroup error: %v\n", err)
+		logging.Error("read cgroup file failed", "path", cGroupV2Path, "err", err)
 		return notRetrievedPath
 	}
 	return extractSystemPathByCGroupV2(string(data))
@@ -96,7 +97,7 @@ func initCGroupV2() bool {
 	var err error
 	cfsQuota, cfsPeriod, err = getCPUQuota()
 	if err != nil {
-		log.Printf("error: initCGroup failed, error:%v", err)
+		logging.Error("init cgroup v2 failed", "err", err)
 		return false
 	}
 	prevCGroupStat = cGroupStat{
@@ -133,11 +134,10 @@ func readCPUUsageByCPUStat() (usage int64, err error) {
 func getCPURateByCGroupV2() (rate float64, err error) {
 	usage, err := readCPUUsageByCPUStat()
 	if err != nil {
-		log.Printf("error: read cpu usage by stat failed, err: %v", err)
-		return retrieveValueFailed, err
+		return retrieveValueFailed, fmt.Errorf("read cpu usage by stat: %w", err)
 	}
 	if usage == prevCGroupStat.cpuUsage {
-		log.Println("error: retrieveValueFailed")
+		logging.Debug("cpu usage not changed", "path", dockerCPUStatPath)
 		return retrieveValueFailed, retrieveValueError
 	}
 	// UnixMicro() 方法是在 go 1.17 之后引入的，为了兼容之前的版本，这里不直接使用该方法
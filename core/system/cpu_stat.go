@@ -16,7 +16,7 @@
 package  system
 
 import (
-	"log"
+	"errors"
 	"math"
 
 	"github.com/shirou/gopsutil/cpu"
@@ -26,14 +26,15 @@ import (
 Get cpu usage rate by cgroup
 */
 var (
-	prevCPUStat *cpu.TimesStat
+	prevCPUStat   *cpu.TimesStat
+	errNoCPUStats = errors.New("no cpu stats retrieved")
 )
 
 func getCPURateByStat() (float64, error) {
 	var cpuRate float64
 	cpuStats, err := cpu.Times(false)
 	if err != nil {
-		log.Printf("warning: Failed to retrieve current CPU usage: %+v", err)
+		return retrieveValueFailed, err
 	}
 	if len(cpuStats) > 0 {
 		curCPUStat := &cpuStats[0]
@@ -44,7 +45,7 @@ func getCPURateByStat() (float64, error) {
 		// Cache the latest CPU stat info.
 		prevCPUStat = curCPUStat
 	} else {
-		log.Println("error: pid_error: len(cpuStats) == 0")
+		return retrieveValueFailed, errNoCPUStats
 	}
 	return cpuRate, nil
 }
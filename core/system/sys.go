@@ -17,13 +17,16 @@ package system
 
 import (
 	"errors"
-	"log"
+	"fmt"
+	"os"
 	"runtime/debug"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/bytedance/pid_limits/core/event"
 	"github.com/bytedance/pid_limits/core/stat"
+	"github.com/bytedance/pid_limits/util/logging"
 	"golang.org/x/sys/unix"
 )
 
@@ -42,24 +45,75 @@ var (
 	retrieveValueError = errors.New("can not retrieveValue from ")
 	errPrevStatsNil    = errors.New("PREV STAT IS NIL")
 	disablePIDLimit    = false
+	cpuSource          = CPUSourceHost
+	// collectorFailing is only accessed by the collector
+	collectorFailing bool
 )
 
+const (
+	CPUSourceCGroupV1 = "cgroupv1"
+	CPUSourceCGroupV2 = "cgroupv2"
+	CPUSourceHost     = "host"
+)
+
+const collectorEventSource = "cpu_collector"
+
+// EnvCPUSource overrides the detected cpu source with one of the CPUSource constants
+const EnvCPUSource = "PLATO_CPU_SOURCE"
+
 func init() {
+	detectCPUSource()
+	if source := os.Getenv(EnvCPUSource); source != "" {
+		if err := setCPUSource(source); err != nil {
+			logging.Warn("ignore invalid environment variable", "name", EnvCPUSource, "err", err)
+			return
+		}
+		logging.Info("cpu source set by environment", "source", source)
+	}
+}
+
+func detectCPUSource() {
 	// judge the file related with CGroup exits of not
 	currentCPUUsage.Store(notRetrievedValue)
 	if isCgroup2UnifiedMode() && initCGroupV2() {
-		log.Println("current version is cgroupv2")
+		logging.Info("cpu usage collected by cgroup", "version", 2)
 		getCPURate = getCPURateByCGroupV2
+		cpuSource = CPUSourceCGroupV2
 		return
 	}
 	if initCGroup() {
-		log.Println("current version is cgroupv1")
+		logging.Info("cpu usage collected by cgroup", "version", 1)
 		getCPURate = getCPURateByCGroup
+		cpuSource = CPUSourceCGroupV1
 		return
 	}
 	disablePIDLimit = true
 }
 
+// setCPUSource forces where the cpu usage is collected from, the detected source is replaced only if the
+// requested one is available, CPUSourceHost collects the usage of the whole host outside a cgroup too
+func setCPUSource(source string) error {
+	switch source {
+	case CPUSourceCGroupV2:
+		if !isCgroup2UnifiedMode() || !initCGroupV2() {
+			return errors.New("system: cgroup v2 is not available")
+		}
+		getCPURate = getCPURateByCGroupV2
+	case CPUSourceCGroupV1:
+		if !initCGroup() {
+			return errors.New("system: cgroup v1 is not available")
+		}
+		getCPURate = getCPURateByCGroup
+	case CPUSourceHost:
+		getCPURate = getCPURateByStat
+	default:
+		return fmt.Errorf("system: unknown cpu source %q", source)
+	}
+	cpuSource = source
+	disablePIDLimit = false
+	return nil
+}
+
 func isCgroup2UnifiedMode() bool {
 	var st unix.Statfs_t
 	err := unix.Statfs(cGroupV2prefixPath, &st)
@@ -82,7 +136,7 @@ func InitCollector(intervalMs uint32) {
 		go func() {
 			defer func() {
 				if err := recover(); err != nil {
-					log.Printf("panic, error : %v, stack : %s", err, debug.Stack())
+					logging.Error("cpu collector panic", "err", err, "stack", string(debug.Stack()))
 				}
 				time.Sleep(time.Second)
 			}()
@@ -102,12 +156,41 @@ func InitCollector(intervalMs uint32) {
 func retrieveAndUpdateCPUUsage() {
 	cpuRate, err := getCPURate()
 	if err != nil {
+		// an unchanged usage counter is expected between two close reads
+		if err != retrieveValueError {
+			collectorFailed(err)
+		}
 		return
 	}
+	if collectorFailing {
+		collectorFailing = false
+		logging.Info("cpu collector recovered", "source", cpuSource)
+	}
 	currentCPUUsage.Store(cpuRate)
 	slidingWindow.Add(int(cpuRate * scale))
 }
 
+// collectorFailed logs and publishes the first failure of a run of failures only, the collector runs every tick
+func collectorFailed(err error) {
+	if collectorFailing {
+		logging.Debug("cpu collector failed", "source", cpuSource, "err", err)
+		return
+	}
+	collectorFailing = true
+	logging.Error("cpu collector failed, the usage is kept until it recovers", "source", cpuSource, "err", err)
+	event.Publish(event.Event{Type: event.CollectorError, Source: collectorEventSource, Err: err})
+}
+
+// CPUSource is where the cpu usage is collected from, one of the CPUSource constants
+func CPUSource() string {
+	return cpuSource
+}
+
+// CPUUsageEnabled reports whether CurrentCPUUsage reports the collected usage, it always reports 0 outside a cgroup
+func CPUUsageEnabled() bool {
+	return !disablePIDLimit
+}
+
 func CurrentCPUUsage() float64 {
 	if disablePIDLimit {
 		return 0
@@ -119,6 +202,19 @@ func CurrentCPUUsage() float64 {
 	return r
 }
 
+// ExtractCPUSamples returns the cpu usages of the window with the unix milliseconds they were collected at,
+// unlike ExtractCPUWindows the samples expire when the collector stops adding new ones
+func ExtractCPUSamples() (timestamps []int64, cpuRates []float64) {
+	for _, point := range slidingWindow.GetDataPoints() {
+		if point.Value == 0 {
+			continue
+		}
+		timestamps = append(timestamps, point.Timestamp)
+		cpuRates = append(cpuRates, float64(point.Value)/scale)
+	}
+	return timestamps, cpuRates
+}
+
 // checkout the cpu slice in order of time
 func ExtractCPUWindows() (cpuRates []float64) {
 	record := slidingWindow.GetData()
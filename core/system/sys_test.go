@@ -16,8 +16,11 @@
 package  system
 
 import (
+	"errors"
 	"testing"
 	"time"
+
+	"github.com/bytedance/pid_limits/core/event"
 )
 
 func TestInitCollector(t *testing.T) {
@@ -68,6 +71,41 @@ func Test_retrieveAndUpdateCPUUsage(t *testing.T) {
 	}
 }
 
+func Test_retrieveAndUpdateCPUUsageFailing(t *testing.T) {
+	failing := true
+	getCPURate = func() (float64, error) {
+		if failing {
+			return retrieveValueFailed, errors.New("read failed")
+		}
+		return 0.5, nil
+	}
+	defer func() {
+		getCPURate = getCPURateByStat
+		collectorFailing = false
+	}()
+	errs := 0
+	unsubscribe := event.Subscribe(func(e event.Event) {
+		if e.Type == event.CollectorError {
+			errs++
+		}
+	})
+	defer unsubscribe()
+
+	for i := 0; i < 5; i++ {
+		retrieveAndUpdateCPUUsage()
+	}
+	if errs != 1 {
+		t.Errorf("collector errors published = %v, want 1 per run of failures", errs)
+	}
+	failing = false
+	retrieveAndUpdateCPUUsage()
+	failing = true
+	retrieveAndUpdateCPUUsage()
+	if errs != 2 {
+		t.Errorf("collector errors published = %v, want 2 after a recovery", errs)
+	}
+}
+
 func TestCurrentCPUUsage(t *testing.T) {
 	tests := []struct {
 		name string
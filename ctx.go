@@ -15,11 +15,17 @@
  */
 package plato
 
-import "github.com/bytedance/pid_limits/util"
+import (
+	"time"
+
+	"github.com/bytedance/pid_limits/util"
+)
 
 type EntryCtx struct {
 	startTime uint64
-	pe        *PlatoEntry
+	// start is the start of the request on the entry clock, rtts below a millisecond are measured from it
+	start time.Time
+	pe    *PlatoEntry
 }
 
 func (c *EntryCtx) GetEntry() *PlatoEntry {
@@ -30,9 +36,22 @@ func (c *EntryCtx) GetStartTime() uint64 {
 	return c.startTime
 }
 
+// Elapsed is the time since the request started
+func (c *EntryCtx) Elapsed() time.Duration {
+	if c.pe == nil {
+		return time.Since(c.start)
+	}
+	return c.pe.clock().Sub(c.start)
+}
+
 func NewCtx(entry *PlatoEntry) *EntryCtx {
+	start := time.Now()
+	if entry != nil {
+		start = entry.clock()
+	}
 	return &EntryCtx{
-		startTime: util.CurrentTimeMillis(),
+		startTime: uint64(start.UnixNano()) / util.UnixTimeUnitOffset,
+		start:     start,
 		pe:        entry,
 	}
 }
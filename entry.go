@@ -21,7 +21,6 @@ import (
 
 	"github.com/bytedance/pid_limits/core/base"
 	"github.com/bytedance/pid_limits/core/stat"
-	"github.com/bytedance/pid_limits/util"
 )
 
 var (
@@ -31,14 +30,7 @@ var (
 //A function create a *PlatoEntry that has metrics represented by calculatedMetrics.
 //Metrics of this *PlatoEntry will not be calculated until they are passed to plato.Init() method
 func NewPlatoEntry(name string, calculateMetrics ...MetricFactory) *PlatoEntry {
-	pe := &PlatoEntry{
-		Rule:       nil,
-		Name:       name,
-		rtt:        stat.NewSlidingWindow(-1, time.Millisecond*time.Duration(base.DefaultIntervalMs)),
-		completion: stat.NewSlidingWindow(-1, time.Millisecond*time.Duration(base.DefaultIntervalMs)),
-		blocked:    stat.NewSlidingWindow(-1, time.Millisecond*time.Duration(base.DefaultIntervalMs)),
-		error:      stat.NewSlidingWindow(-1, time.Millisecond*time.Duration(base.DefaultIntervalMs)),
-	}
+	pe := newPlatoEntry(name, time.Millisecond*time.Duration(base.DefaultIntervalMs), time.Now)
 
 	for _, m := range calculateMetrics {
 		pe.AddMetric(m)
@@ -47,6 +39,19 @@ func NewPlatoEntry(name string, calculateMetrics ...MetricFactory) *PlatoEntry {
 	return pe
 }
 
+func newPlatoEntry(name string, interval time.Duration, now func() time.Time) *PlatoEntry {
+	return &PlatoEntry{
+		Rule:       nil,
+		Name:       name,
+		Metrics:    map[MetricFactory]*Metric{},
+		now:        now,
+		rtt:        stat.NewSlidingWindowWithClock(-1, interval, now),
+		completion: stat.NewSlidingWindowWithClock(-1, interval, now),
+		blocked:    stat.NewSlidingWindowWithClock(-1, interval, now),
+		error:      stat.NewSlidingWindowWithClock(-1, interval, now),
+	}
+}
+
 //A function create a *PlatoEntry that has metrics of pct99 latency、avg latency、error rate and qps.
 //Metrics of this *PlatoEntry will not be calculated in background until they are passed to plato.Init() method
 func DefaultEntry(name string) *PlatoEntry {
@@ -73,6 +78,7 @@ type PlatoEntry struct {
 	completion *stat.SlidingWindow
 	blocked    *stat.SlidingWindow
 	error      *stat.SlidingWindow
+	now        func() time.Time
 }
 
 //A helper function to use entry, avoid typo error.
@@ -83,8 +89,9 @@ func (pe *PlatoEntry) Run(r func() error) (error, bool) {
 		return ErrRejectByRule, b
 	}
 
+	// the rule is told about the exit even if r panics, or the requests it keeps in flight would leak
+	defer pe.Exit(c)
 	e := r()
-	pe.Exit(c)
 	if e != nil {
 		pe.ReportError(e)
 	}
@@ -92,14 +99,16 @@ func (pe *PlatoEntry) Run(r func() error) (error, bool) {
 }
 
 func (pe *PlatoEntry) Exit(ctx *EntryCtx) {
-	rt := util.CurrentTimeMillis() - ctx.startTime
-	pe.rtt.Add(int(rt))
+	rtt := ctx.Elapsed()
+	pe.rtt.Add(int(rtt / time.Millisecond))
 	pe.completion.Add(1)
+	if l, ok := pe.Rule.(ExitListener); ok {
+		l.OnExit(ctx, rtt)
+	}
 }
 
 func (pe *PlatoEntry) Entry() (*EntryCtx, bool) {
 	ctx := NewCtx(pe)
-	ctx.startTime = util.CurrentTimeMillis()
 
 	if pe.Rule == nil {
 		return ctx, true
@@ -111,6 +120,13 @@ func (pe *PlatoEntry) Entry() (*EntryCtx, bool) {
 	}
 }
 
+func (pe *PlatoEntry) clock() time.Time {
+	if pe.now == nil {
+		return time.Now()
+	}
+	return pe.now()
+}
+
 func (pe *PlatoEntry) ReportError(err error) {
 	pe.error.Add(1)
 }
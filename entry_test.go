@@ -90,3 +90,28 @@ func TestEntry(t *testing.T) {
 	assert.True(t, i1 == 0)
 	assert.False(t, b)
 }
+
+type exitRule struct {
+	exits int
+}
+
+func (r *exitRule) Decide(ctx *EntryCtx) bool {
+	return true
+}
+
+func (r *exitRule) OnExit(ctx *EntryCtx, rtt time.Duration) {
+	r.exits++
+}
+
+func TestEntryRunPanic(t *testing.T) {
+	entry := DefaultEntry("")
+	rule := &exitRule{}
+	entry.Rule = rule
+	assert.Panics(t, func() {
+		entry.Run(func() error {
+			panic("handler")
+		})
+	})
+	assert.Equal(t, 1, rule.exits)
+	assert.Equal(t, 1, entry.completion.GetSum())
+}
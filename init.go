@@ -17,10 +17,15 @@ package  plato
 
 import (
 	"runtime"
+	"sync"
 )
 
 var (
 	calManager *CalculateManager
+
+	entriesLock sync.RWMutex
+	entries     []*PlatoEntry
+	entrySet    = map[*PlatoEntry]struct{}{}
 )
 
 func init() {
@@ -40,6 +45,14 @@ func init() {
 //Init will put metrics of input PlatoEntries into background calculating goroutine
 func Init(es []*PlatoEntry) {
 	var metrics []*Metric
+	entriesLock.Lock()
+	for _, e := range es {
+		if _, ok := entrySet[e]; !ok {
+			entrySet[e] = struct{}{}
+			entries = append(entries, e)
+		}
+	}
+	entriesLock.Unlock()
 	for _, e := range es {
 		for _, m := range e.Metrics {
 			metrics = append(metrics, m)
@@ -47,3 +60,15 @@ func Init(es []*PlatoEntry) {
 	}
 	calManager.AddMetrics(metrics...)
 }
+
+//DefaultCalculateManager returns the CalculateManager calculating the metrics of the entries passed to Init
+func DefaultCalculateManager() *CalculateManager {
+	return calManager
+}
+
+//Entries returns the PlatoEntries passed to Init, in the order they were first passed
+func Entries() []*PlatoEntry {
+	entriesLock.RLock()
+	defer entriesLock.RUnlock()
+	return append([]*PlatoEntry(nil), entries...)
+}
@@ -36,3 +36,18 @@ func TestInit(t *testing.T) {
 		})
 	}
 }
+
+func TestEntries(t *testing.T) {
+	e := DefaultEntry("test_entries")
+	Init([]*PlatoEntry{e})
+	Init([]*PlatoEntry{e})
+	n := 0
+	for _, registered := range Entries() {
+		if registered == e {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("Entries() contains the entry %d times, want 1", n)
+	}
+}
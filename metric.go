@@ -16,8 +16,7 @@
 package plato
 
 import (
-	"sort"
-
+	"github.com/bytedance/pid_limits/arithmetic/common"
 	"github.com/bytedance/pid_limits/util"
 )
 
@@ -44,15 +43,16 @@ var (
 		}
 	})
 
+	// PctRT is the p90 of the rtt within the window, interpolated between the closest ranks
 	PctRT = CreateMetricFactory(func(entry *PlatoEntry) *Metric {
 		return &Metric{
 			cul: func() float64 {
-				a := entry.rtt.GetData()
-				sort.Ints(a)
-				if len(a) == 0 {
-					return 0
+				data := entry.rtt.GetData()
+				rtts := make([]float64, len(data))
+				for i, rtt := range data {
+					rtts[i] = float64(rtt)
 				}
-				return float64(a[int(len(a)/10*9)])
+				return common.SelectPercentile(rtts, 0.9)
 			},
 		}
 	})
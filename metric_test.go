@@ -31,6 +31,16 @@ func TestMetricMap(t *testing.T) {
 	assert.True(t, pe.Metrics[PctRT] != nil)
 }
 
+func TestPctRT(t *testing.T) {
+	pe := NewPlatoEntry("", PctRT)
+	assert.Equal(t, 0.0, pe.Metrics[PctRT].cul())
+	for _, rt := range []int{10, 1, 9, 2, 8, 3, 7, 4, 6, 5} {
+		pe.rtt.Add(rt)
+	}
+	// the p90 of ten samples lies between the 9th and the 10th
+	assert.InDelta(t, 9.1, pe.Metrics[PctRT].cul(), 1e-9)
+}
+
 func TestQps(t *testing.T) {
 	pe := DefaultEntry("")
 	Init([]*PlatoEntry{pe})
@@ -0,0 +1,86 @@
+package cpu
+
+import (
+	"sync/atomic"
+
+	"github.com/bytedance/pid_limits/util/logging"
+)
+
+// confirm flips the overload flag of a monitor once the decided cpu usage stayed above the upper bound, or below the
+// lower bound, for the configured consecutive decisions
+type confirm struct {
+	upperThreshold func() float64
+	lowerThreshold func() float64
+	overload       atomic.Value
+	continuousTime uint32 // 记录连续低于阈值的次数
+	enterTimes     uint32
+	exitTimes      uint32
+	emergency      float64
+}
+
+func (c *confirm) init(opts *Options) {
+	c.upperThreshold = opts.upperThreshold
+	c.lowerThreshold = opts.lowerThreshold
+	c.enterTimes = opts.enterTimes
+	c.exitTimes = opts.exitTimes
+	c.emergency = opts.emergency
+	c.overload.Store(opts.overload)
+}
+
+func (c *confirm) IsOverload() bool {
+	if overload, ok := c.overload.Load().(bool); ok {
+		return overload
+	}
+	logging.Error("adaptive failed to get overload information from monitor")
+	return false
+}
+
+func (c *confirm) state(alg MonitorAlg) MonitorState {
+	return MonitorState{
+		Alg:             alg,
+		Overload:        c.IsOverload(),
+		UpperThreshold:  c.upperThreshold(),
+		LowerThreshold:  c.lowerThreshold(),
+		ContinuousTimes: atomic.LoadUint32(&c.continuousTime),
+	}
+}
+
+// decide counts the decision on avgCPU, rateWindows and windows are the samples it was computed from, for the logs
+func (c *confirm) decide(avgCPU float64, rateWindows, windows []float64) {
+	c.decideOn(avgCPU, avgCPU >= c.emergency, rateWindows, windows)
+}
+
+// decideOn is decide with the caller telling whether the start of the limiting can skip the confirmation
+func (c *confirm) decideOn(avgCPU float64, urgent bool, rateWindows, windows []float64) {
+	if c.IsOverload() {
+		c.decideLessLoad(avgCPU, rateWindows, windows)
+	} else {
+		c.decideOverLoad(avgCPU, urgent, rateWindows, windows)
+	}
+}
+
+func (c *confirm) decideOverLoad(avgCPU float64, urgent bool, rateWindows, windows []float64) {
+	// 在没有过载的时候，需要连续 enterTimes 个计算周期【默认3秒】中，每次CPU平均值高于阈值上限
+	// 如果 cpu 负载过高，可能导致协程无法按 interval 转一次，后续若干秒转一次
+	if avgCPU >= c.upperThreshold() && (atomic.AddUint32(&c.continuousTime, 1) > c.enterTimes || urgent) {
+		logging.Warn("adaptive limiting start", "rateWindows", rateWindows, "windows", windows)
+		c.overload.Store(true)
+		atomic.StoreUint32(&c.continuousTime, 0)
+	}
+
+	if avgCPU < c.lowerThreshold() {
+		atomic.StoreUint32(&c.continuousTime, 0)
+	}
+}
+
+func (c *confirm) decideLessLoad(avgCPU float64, rateWindows, windows []float64) {
+	if avgCPU < c.lowerThreshold() && atomic.AddUint32(&c.continuousTime, 1) > c.exitTimes {
+		logging.Warn("adaptive limiting end", "rateWindows", rateWindows, "windows", windows)
+		c.overload.Store(false)
+		atomic.StoreUint32(&c.continuousTime, 0)
+	}
+	if avgCPU >= c.upperThreshold() {
+		// 如果有一次阈值高于上限，都需要将其清零
+		atomic.StoreUint32(&c.continuousTime, 0)
+	}
+}
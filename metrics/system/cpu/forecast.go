@@ -0,0 +1,122 @@
+package cpu
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ForecastModel is the trend fitted by the Forecast monitor
+type ForecastModel int
+
+const (
+	// ForecastLinear fits a least squares line to the window
+	ForecastLinear ForecastModel = iota
+	// ForecastHolt smooths the level and the trend of the window, Holt's double exponential smoothing
+	ForecastHolt
+)
+
+// ParseForecastModel parses the name returned by ForecastModel.String
+func ParseForecastModel(name string) (ForecastModel, error) {
+	for _, model := range []ForecastModel{ForecastLinear, ForecastHolt} {
+		if model.String() == name {
+			return model, nil
+		}
+	}
+	return 0, fmt.Errorf("cpu: unknown forecast model %q", name)
+}
+
+func (model ForecastModel) String() string {
+	switch model {
+	case ForecastLinear:
+		return "linear"
+	case ForecastHolt:
+		return "holt"
+	}
+	return "unknown"
+}
+
+// Prediction is the last forecast of the Forecast monitor
+type Prediction struct {
+	Model ForecastModel
+	// Level is the fitted cpu usage at the last sample, Slope its change per second
+	Level float64
+	Slope float64
+	// Forecast is the cpu usage projected Horizon ahead
+	Forecast float64
+	Horizon  time.Duration
+	// TimeToBreach is when the trend crosses the upper bound, 0 if the level is above it already, -1 if it never does
+	TimeToBreach time.Duration
+}
+
+// linearTrend is the least squares line of samples taken at times, in seconds, its value at the last sample
+// and its slope per second
+func linearTrend(times, samples []float64) (level, slope float64) {
+	n := float64(len(samples))
+	if len(samples) < 2 {
+		return sampleAt(samples, 0), 0
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i, y := range samples {
+		x := times[i]
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator <= 0 {
+		// every sample was taken at the same time, there is no trend
+		return sumY / n, 0
+	}
+	slope = (n*sumXY - sumX*sumY) / denominator
+	intercept := (sumY - slope*sumX) / n
+	return intercept + slope*times[len(times)-1], slope
+}
+
+// holtTrend smooths the level with alpha and the trend with beta over samples taken at times, in seconds,
+// it returns them at the last sample, the trend per second
+func holtTrend(times, samples []float64, alpha, beta float64) (level, slope float64) {
+	if len(samples) < 2 {
+		return sampleAt(samples, 0), 0
+	}
+	level = samples[0]
+	if dt := times[1] - times[0]; dt > 0 {
+		slope = (samples[1] - samples[0]) / dt
+	}
+	for i, v := range samples[1:] {
+		dt := times[i+1] - times[i]
+		prev := level
+		level = alpha*v + (1-alpha)*(level+slope*dt)
+		if dt > 0 {
+			slope = beta*(level-prev)/dt + (1-beta)*slope
+		}
+	}
+	return level, slope
+}
+
+func sampleAt(samples []float64, i int) float64 {
+	if i < len(samples) {
+		return samples[i]
+	}
+	return 0
+}
+
+// predict projects the trend horizon ahead, perSecond is the slope of the trend
+func predict(model ForecastModel, level, perSecond float64, horizon time.Duration, upper float64) Prediction {
+	p := Prediction{
+		Model:        model,
+		Level:        level,
+		Slope:        perSecond,
+		Forecast:     level + perSecond*horizon.Seconds(),
+		Horizon:      horizon,
+		TimeToBreach: -1,
+	}
+	switch {
+	case level >= upper:
+		p.TimeToBreach = 0
+	case perSecond > 0:
+		p.TimeToBreach = time.Duration(math.Ceil((upper - level) / perSecond * float64(time.Second)))
+	}
+	return p
+}
@@ -16,13 +16,16 @@
 package cpu
 
 import (
-	"log"
+	"math"
 
 	"github.com/bytedance/pid_limits/core/system"
+	"github.com/bytedance/pid_limits/util/logging"
 )
 
 const (
 	cpuCollectorIntervalMs = 100
+	// cpuCollectorSize is how many samples the window of the cpu collector keeps, within 6s
+	cpuCollectorSize = 100
 )
 
 func init() {
@@ -40,21 +43,104 @@ type Monitor interface {
 	IsOverload() bool
 }
 
+// MonitorState is the live state of a monitor, ContinuousTimes counts the consecutive decisions
+// towards flipping the overload flag
+type MonitorState struct {
+	Alg             MonitorAlg
+	Overload        bool
+	UpperThreshold  float64
+	LowerThreshold  float64
+	ContinuousTimes uint32
+	// Prediction is the last forecast of the Forecast monitor, nil for the other monitors
+	Prediction *Prediction
+}
+
+// StateMonitor is implemented by the monitors of this package
+type StateMonitor interface {
+	State() MonitorState
+}
+
+// StoppableMonitor is implemented by the monitors of this package, Stop ends the background goroutine
+type StoppableMonitor interface {
+	Stop()
+}
+
+// NewMonitor builds a monitor, it returns an error if a threshold is outside 0 ~ 1, the lower bound is above the upper
+// bound, the algorithm is unknown or the z-score is not positive
+func NewMonitor(ops ...Option) (Monitor, error) {
+	opts := newOptions()
+	for _, do := range ops {
+		do.f(opts)
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	return newMonitor(opts), nil
+}
+
+// NewCPUMonitor is NewMonitor reporting invalid options instead of failing, the thresholds are clamped into 0 ~ 1,
+// an unknown algorithm falls back to Raw and the other invalid options to their defaults
 func NewCPUMonitor(ops ...Option) Monitor {
 	opts := newOptions()
 	for _, do := range ops {
 		do.f(opts)
 	}
-	threshold := opts.upperThreshold()
-	if threshold < 0 || threshold > 1 {
-		log.Fatal("cpu usage threshold should be in 0 ~ 1")
+	if err := opts.validate(); err != nil {
+		logging.Error("invalid cpu monitor options, the thresholds are clamped", "err", err)
 	}
+	if !(opts.score > 0) {
+		opts.score = score
+	}
+	if opts.interval <= 0 {
+		opts.interval = interval
+	}
+	if opts.windowSize <= 0 || opts.windowLength <= 0 {
+		opts.windowSize, opts.windowLength = 0, 0
+	}
+	if !(opts.alpha > 0 && opts.alpha <= 1) {
+		opts.alpha = defaultAlpha
+	}
+	if !(opts.percentile >= 0 && opts.percentile <= 1) {
+		opts.percentile = defaultPercentile
+	}
+	if opts.source == nil {
+		opts.source = collectorSource{}
+	}
+	if opts.forecastModel != ForecastLinear && opts.forecastModel != ForecastHolt {
+		opts.forecastModel = ForecastLinear
+	}
+	if opts.horizon < 0 {
+		opts.horizon = DefaultHorizon
+	}
+	if !(opts.beta > 0 && opts.beta <= 1) {
+		opts.beta = defaultBeta
+	}
+	opts.upperThreshold = clampBound(opts.upperThreshold, threshold)
+	opts.lowerThreshold = clampBound(opts.lowerThreshold, lowerThreshold)
+	return newMonitor(opts)
+}
 
+func newMonitor(opts *Options) Monitor {
 	switch opts.alg {
 	case ZScore:
 		return NewMonitorZScore(opts)
 	case Raw:
 		return NewMonitorRaw(opts)
+	case EWMA, MAD, Percentile:
+		return NewMonitorStat(opts)
+	case Forecast:
+		return NewMonitorForecast(opts)
 	}
 	return NewMonitorRaw(opts)
 }
+
+// clampBound keeps a threshold in 0 ~ 1, NaN is replaced by fallback
+func clampBound(f func() float64, fallback float64) func() float64 {
+	return func() float64 {
+		v := f()
+		if math.IsNaN(v) {
+			return fallback
+		}
+		return math.Min(1, math.Max(0, v))
+	}
+}
@@ -0,0 +1,111 @@
+package cpu
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/pid_limits/util"
+)
+
+// MonitorForecast decides the overload on the cpu usage projected a horizon ahead by the trend of the window, so the
+// limiting starts before the usage crosses the upper bound. It has the same confirmation as MonitorZScore, except that
+// the limiting starts early when the usage would cross the bound before the confirmation completes, and the emergency
+// threshold applies to the measured usage rather than the forecast. The trend is fitted on the time of the samples
+type MonitorForecast struct {
+	confirm
+	model      ForecastModel
+	alpha      float64
+	beta       float64
+	horizon    time.Duration
+	step       time.Duration
+	prediction atomic.Value // Prediction
+	initOnce   sync.Once
+	stopOnce   sync.Once
+	stop       chan struct{}
+	interval   time.Duration
+	window     usageWindow
+}
+
+func NewMonitorForecast(opts *Options) Monitor {
+	monitor := newMonitorForecast(opts)
+	monitor.start()
+	return monitor
+}
+
+func newMonitorForecast(opts *Options) *MonitorForecast {
+	monitor := &MonitorForecast{
+		model:    opts.forecastModel,
+		alpha:    opts.alpha,
+		beta:     opts.beta,
+		horizon:  opts.horizon,
+		step:     opts.interval,
+		stop:     make(chan struct{}),
+		interval: opts.interval,
+		window:   newUsageWindow(opts),
+	}
+	if monitor.window.own == nil {
+		// the samples of a source without their times are taken at the pace of the collector
+		monitor.step = cpuCollectorIntervalMs * time.Millisecond
+	}
+	monitor.confirm.init(opts)
+	return monitor
+}
+
+func (monitor *MonitorForecast) State() MonitorState {
+	state := monitor.confirm.state(Forecast)
+	if p, ok := monitor.prediction.Load().(Prediction); ok {
+		state.Prediction = &p
+	}
+	return state
+}
+
+// Prediction returns the last forecast, false before the first decision
+func (monitor *MonitorForecast) Prediction() (Prediction, bool) {
+	p, ok := monitor.prediction.Load().(Prediction)
+	return p, ok
+}
+
+func (monitor *MonitorForecast) start() {
+	monitor.initOnce.Do(func() {
+		go util.LoopWithIntervalUntil(func() {
+			monitor.decide()
+		}, monitor.interval, monitor.stop)
+	})
+}
+
+// Stop ends the background goroutine, the overload flag is frozen
+func (monitor *MonitorForecast) Stop() {
+	monitor.stopOnce.Do(func() {
+		close(monitor.stop)
+	})
+}
+
+func (monitor *MonitorForecast) decide() {
+	times, samples := monitor.window.timedSamples(monitor.step)
+	if len(samples) == 0 {
+		return
+	}
+	var level, slope float64
+	if monitor.model == ForecastHolt {
+		level, slope = holtTrend(times, samples, monitor.alpha, monitor.beta)
+	} else {
+		level, slope = linearTrend(times, samples)
+	}
+	p := predict(monitor.model, level, slope, monitor.horizon, monitor.upperThreshold())
+	monitor.prediction.Store(p)
+	// the emergency threshold applies to the measured usage, a forecast above it is no reason to skip the confirmation
+	urgent := samples[len(samples)-1] >= monitor.emergency || monitor.breachesBeforeConfirmed(p)
+	monitor.confirm.decideOn(p.Forecast, urgent, samples, []float64{p.Forecast})
+}
+
+// breachesBeforeConfirmed reports whether a rising usage crosses the upper bound before the remaining confirmations
+// are counted, waiting for them would start the limiting after the breach the forecast is meant to anticipate.
+// A usage already above the bound goes through the confirmation like the other monitors
+func (monitor *MonitorForecast) breachesBeforeConfirmed(p Prediction) bool {
+	if p.TimeToBreach <= 0 {
+		return false
+	}
+	remaining := int64(monitor.enterTimes) - int64(atomic.LoadUint32(&monitor.continuousTime))
+	return p.TimeToBreach <= time.Duration(remaining)*monitor.interval
+}
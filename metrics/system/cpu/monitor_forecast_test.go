@@ -0,0 +1,160 @@
+package cpu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ramp(from, step float64, n int) []float64 {
+	samples := make([]float64, n)
+	for i := range samples {
+		samples[i] = from + step*float64(i)
+	}
+	return samples
+}
+
+// evenly is the times of n samples step seconds apart, relative to the last one
+func evenly(n int, step float64) []float64 {
+	times := make([]float64, n)
+	for i := range times {
+		times[i] = float64(i-n+1) * step
+	}
+	return times
+}
+
+func TestTrend(t *testing.T) {
+	level, slope := linearTrend(evenly(10, 0.1), ramp(0.5, 0.01, 10))
+	assert.InDelta(t, 0.59, level, 1e-9)
+	assert.InDelta(t, 0.1, slope, 1e-9)
+	level, slope = holtTrend(evenly(10, 0.1), ramp(0.5, 0.01, 10), 0.5, 0.5)
+	assert.InDelta(t, 0.59, level, 1e-9)
+	assert.InDelta(t, 0.1, slope, 1e-9)
+
+	// a gap in the samples does not steepen the trend
+	times := []float64{-1.0, -0.9, -0.8, -0.2, -0.1, 0}
+	samples := []float64{0.5, 0.51, 0.52, 0.58, 0.59, 0.6}
+	level, slope = linearTrend(times, samples)
+	assert.InDelta(t, 0.6, level, 1e-9)
+	assert.InDelta(t, 0.1, slope, 1e-9)
+	level, slope = holtTrend(times, samples, 0.5, 0.5)
+	assert.InDelta(t, 0.6, level, 1e-9)
+	assert.InDelta(t, 0.1, slope, 1e-9)
+
+	level, slope = linearTrend([]float64{0, 0}, []float64{0.6, 0.8})
+	assert.Equal(t, []float64{0.7, 0}, []float64{level, slope})
+	level, slope = linearTrend([]float64{0}, []float64{0.7})
+	assert.Equal(t, []float64{0.7, 0}, []float64{level, slope})
+	level, slope = holtTrend(nil, nil, 0.5, 0.5)
+	assert.Equal(t, []float64{0, 0}, []float64{level, slope})
+}
+
+func TestPredict(t *testing.T) {
+	p := predict(ForecastLinear, 0.6, 0.1, 2*time.Second, 0.8)
+	assert.InDelta(t, 0.1, p.Slope, 1e-9)
+	assert.InDelta(t, 0.8, p.Forecast, 1e-9)
+	assert.InDelta(t, float64(2*time.Second), float64(p.TimeToBreach), float64(time.Millisecond))
+
+	assert.Equal(t, time.Duration(0), predict(ForecastLinear, 0.85, 0, time.Second, 0.8).TimeToBreach)
+	assert.Equal(t, time.Duration(-1), predict(ForecastLinear, 0.6, -0.01, time.Second, 0.8).TimeToBreach)
+}
+
+func TestUsageWindowTimedSamples(t *testing.T) {
+	source := &timedSource{timestamps: []int64{1000, 1100, 1500}, usages: []float64{0.5, 0.6, 0.7}}
+	w := newUsageWindow(testOptions(t, WithSource(source)))
+	times, samples := w.timedSamples(100 * time.Millisecond)
+	assert.InDeltaSlice(t, []float64{-0.5, -0.4, 0}, times, 1e-9)
+	assert.Equal(t, []float64{0.5, 0.6, 0.7}, samples)
+
+	w = newUsageWindow(testOptions(t, WithSource(&scriptedSource{windows: [][]float64{{0.5, 0.6}}})))
+	times, _ = w.timedSamples(100 * time.Millisecond)
+	assert.InDeltaSlice(t, []float64{-0.1, 0}, times, 1e-9)
+}
+
+// timedSource is a TimedSource returning the same samples on every call
+type timedSource struct {
+	timestamps []int64
+	usages     []float64
+}
+
+func (s *timedSource) Usage() float64 {
+	return s.usages[len(s.usages)-1]
+}
+
+func (s *timedSource) Samples() []float64 {
+	return s.usages
+}
+
+func (s *timedSource) TimedSamples() ([]int64, []float64) {
+	return s.timestamps, s.usages
+}
+
+func TestMonitorForecastConfirmation(t *testing.T) {
+	bound := func(v float64) func() float64 { return func() float64 { return v } }
+	forecast := func(source Source, horizon time.Duration) *MonitorForecast {
+		return newMonitorForecast(testOptions(t, WithAlg(Forecast), WithSource(source), WithForecast(ForecastLinear, horizon),
+			WithUpperBound(bound(0.8)), WithLowerBound(bound(0.5)), WithContinuousTimes(30, 30), WithInterval(100*time.Millisecond)))
+	}
+	decisions := func(m *MonitorForecast) int {
+		var n int
+		for !m.IsOverload() && n < 100 {
+			m.decide()
+			n++
+		}
+		return n
+	}
+	// 30 confirmations take 3s, a breach in 2s starts the limiting right away
+	m := forecast(&timedSource{timestamps: []int64{0, 2000}, usages: []float64{0.6, 0.7}}, 4*time.Second)
+	assert.Equal(t, 1, decisions(m))
+	// a breach in 5s leaves the time to confirm it
+	m = forecast(&timedSource{timestamps: []int64{0, 5000}, usages: []float64{0.6, 0.7}}, 10*time.Second)
+	assert.Equal(t, 31, decisions(m))
+
+	// a forecast above the emergency threshold still goes through the confirmation
+	steep := &timedSource{timestamps: []int64{0, 100}, usages: []float64{0.8, 0.85}}
+	m = newMonitorForecast(testOptions(t, WithAlg(Forecast), WithSource(steep), WithForecast(ForecastLinear, 3*time.Second),
+		WithUpperBound(bound(0.8)), WithLowerBound(bound(0.5)), WithContinuousTimes(3, 3), WithEmergencyThreshold(0.9)))
+	m.decide()
+	p, _ := m.Prediction()
+	assert.Greater(t, p.Forecast, 0.9)
+	assert.False(t, m.IsOverload())
+	for i := 0; i < 3; i++ {
+		m.decide()
+	}
+	assert.True(t, m.IsOverload())
+
+	// the measured usage above it skips the confirmation
+	m = newMonitorForecast(testOptions(t, WithAlg(Forecast), WithSource(&timedSource{timestamps: []int64{0, 100}, usages: []float64{0.95, 0.95}}),
+		WithUpperBound(bound(0.8)), WithLowerBound(bound(0.5)), WithContinuousTimes(3, 3), WithEmergencyThreshold(0.9)))
+	m.decide()
+	assert.True(t, m.IsOverload())
+}
+
+func TestMonitorForecast(t *testing.T) {
+	bound := func(v float64) func() float64 { return func() float64 { return v } }
+	for _, model := range []ForecastModel{ForecastLinear, ForecastHolt} {
+		rising := ramp(0.5, 0.01, 20) // 0.69 at the last sample, rising 0.1 per second
+		source := &scriptedSource{windows: [][]float64{rising, rising, ramp(0.5, 0, 20), ramp(0.5, 0, 20)}}
+		m := newMonitorForecast(testOptions(t, WithAlg(Forecast), WithSource(source), WithForecast(model, 2*time.Second),
+			WithUpperBound(bound(0.8)), WithLowerBound(bound(0.7)), WithContinuousTimes(1, 1), WithEmergencyThreshold(2)))
+		_, ok := m.Prediction()
+		assert.False(t, ok)
+
+		m.decide()
+		p, ok := m.Prediction()
+		assert.True(t, ok)
+		assert.Equal(t, model, p.Model)
+		assert.InDelta(t, 0.89, p.Forecast, 1e-6, model.String())
+		assert.InDelta(t, float64(1100*time.Millisecond), float64(p.TimeToBreach), float64(time.Millisecond), model.String())
+		assert.False(t, m.IsOverload())
+		// the projected usage crosses the upper bound before the usage does
+		m.decide()
+		assert.True(t, m.IsOverload(), model.String())
+		assert.Equal(t, &p, m.State().Prediction)
+
+		m.decide()
+		m.decide()
+		assert.False(t, m.IsOverload(), model.String())
+	}
+}
@@ -16,67 +16,90 @@
 package cpu
 
 import (
-	"log"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/bytedance/pid_limits/util"
-)
-
-const (
-	waitTime = 6 * time.Second
+	"github.com/bytedance/pid_limits/util/logging"
 )
 
 type MonitorRaw struct {
-	upperThreshold float64
-	lowerThreshold float64
+	upperThreshold func() float64
+	lowerThreshold func() float64
 	overload       atomic.Value
 	initOnce       sync.Once
+	stopOnce       sync.Once
+	stop           chan struct{}
+	interval       time.Duration
+	enterWait      time.Duration
+	exitWait       time.Duration
+	source         Source
 }
 
 func NewMonitorRaw(opts *Options) Monitor {
 	monitor := &MonitorRaw{
-		upperThreshold: opts.upperThreshold(),
-		lowerThreshold: opts.lowerThreshold(),
+		upperThreshold: opts.upperThreshold,
+		lowerThreshold: opts.lowerThreshold,
 		overload:       atomic.Value{},
 		initOnce:       sync.Once{},
+		stop:           make(chan struct{}),
+		interval:       opts.interval,
+		enterWait:      opts.enterWait,
+		exitWait:       opts.exitWait,
+		source:         opts.source,
 	}
-	monitor.overload.Store(false)
+	monitor.overload.Store(opts.overload)
 	monitor.start()
 	return monitor
 }
 
 func (monitor *MonitorRaw) IsOverload() bool {
 	if monitor == nil {
-		log.Println("error: adaptive cpu Monitor is nil")
+		logging.Error("adaptive cpu monitor is nil")
 		return false
 	}
 	if overload, ok := monitor.overload.Load().(bool); ok {
 		return overload
 	}
-	log.Println("adaptive failed to get overload information from Monitor")
+	logging.Error("adaptive failed to get overload information from monitor")
 	return false
 }
 
+func (monitor *MonitorRaw) State() MonitorState {
+	return MonitorState{
+		Alg:            Raw,
+		Overload:       monitor.IsOverload(),
+		UpperThreshold: monitor.upperThreshold(),
+		LowerThreshold: monitor.lowerThreshold(),
+	}
+}
+
 func (monitor *MonitorRaw) start() {
 	monitor.initOnce.Do(func() {
-		go util.LoopWithInterval(func() {
-			usage := GetUsage()
-			if usage >= monitor.upperThreshold && !monitor.IsOverload() {
-				time.Sleep(waitTime)
-				if GetUsage() >= monitor.upperThreshold {
+		go util.LoopWithIntervalUntil(func() {
+			usage := monitor.source.Usage()
+			if usage >= monitor.upperThreshold() && !monitor.IsOverload() {
+				time.Sleep(monitor.enterWait)
+				if monitor.source.Usage() >= monitor.upperThreshold() {
 					monitor.overload.Store(true)
 				}
 				return
 			}
-			if usage < monitor.lowerThreshold && monitor.IsOverload() {
-				time.Sleep(waitTime)
-				if GetUsage() < monitor.lowerThreshold {
+			if usage < monitor.lowerThreshold() && monitor.IsOverload() {
+				time.Sleep(monitor.exitWait)
+				if monitor.source.Usage() < monitor.lowerThreshold() {
 					monitor.overload.Store(false)
 				}
 				return
 			}
-		}, 100*time.Millisecond)
+		}, monitor.interval, monitor.stop)
+	})
+}
+
+// Stop ends the background goroutine, the overload flag is frozen
+func (monitor *MonitorRaw) Stop() {
+	monitor.stopOnce.Do(func() {
+		close(monitor.stop)
 	})
 }
@@ -0,0 +1,41 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package cpu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonitorRawStop(t *testing.T) {
+	opts := newOptions()
+	WithInitialOverload(true).f(opts)
+	WithUpperBound(func() float64 { return 0.9 }).f(opts)
+	WithLowerBound(func() float64 { return 0.7 }).f(opts)
+	monitor := NewMonitorRaw(opts).(*MonitorRaw)
+	assert.True(t, monitor.IsOverload())
+	assert.Equal(t, MonitorState{Alg: Raw, Overload: true, UpperThreshold: 0.9, LowerThreshold: 0.7}, monitor.State())
+
+	monitor.Stop()
+	monitor.Stop()
+	select {
+	case <-monitor.stop:
+	case <-time.After(time.Second):
+		t.Fatal("monitor not stopped")
+	}
+}
@@ -0,0 +1,84 @@
+package cpu
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bytedance/pid_limits/arithmetic/common"
+	"github.com/bytedance/pid_limits/util"
+)
+
+// MonitorStat decides the overload on a statistic of the window, the EWMA, the average without the MAD outliers or a
+// percentile, with the same confirmation as MonitorZScore
+type MonitorStat struct {
+	confirm
+	alg        MonitorAlg
+	alpha      float64
+	score      float64
+	percentile float64
+	initOnce   sync.Once
+	stopOnce   sync.Once
+	stop       chan struct{}
+	interval   time.Duration
+	window     usageWindow
+}
+
+func NewMonitorStat(opts *Options) Monitor {
+	monitor := newMonitorStat(opts)
+	monitor.start()
+	return monitor
+}
+
+func newMonitorStat(opts *Options) *MonitorStat {
+	monitor := &MonitorStat{
+		alg:        opts.alg,
+		alpha:      opts.alpha,
+		score:      opts.score,
+		percentile: opts.percentile,
+		stop:       make(chan struct{}),
+		interval:   opts.interval,
+		window:     newUsageWindow(opts),
+	}
+	monitor.confirm.init(opts)
+	return monitor
+}
+
+func (monitor *MonitorStat) State() MonitorState {
+	return monitor.confirm.state(monitor.alg)
+}
+
+func (monitor *MonitorStat) start() {
+	monitor.initOnce.Do(func() {
+		go util.LoopWithIntervalUntil(func() {
+			monitor.decide()
+		}, monitor.interval, monitor.stop)
+	})
+}
+
+// Stop ends the background goroutine, the overload flag is frozen
+func (monitor *MonitorStat) Stop() {
+	monitor.stopOnce.Do(func() {
+		close(monitor.stop)
+	})
+}
+
+func (monitor *MonitorStat) decide() {
+	rateWindows := monitor.window.samples()
+	if len(rateWindows) == 0 {
+		return
+	}
+	level, windows := monitor.level(rateWindows)
+	monitor.confirm.decide(level, rateWindows, windows)
+}
+
+// level is the statistic of the samples compared to the bounds, and the samples it was computed from
+func (monitor *MonitorStat) level(samples []float64) (float64, []float64) {
+	switch monitor.alg {
+	case EWMA:
+		return common.EWMA(samples, monitor.alpha), samples
+	case MAD:
+		kept := common.MADFilter(samples, monitor.score)
+		return common.AverageFloat(kept), kept
+	}
+	return common.Percentile(samples, monitor.percentile), samples
+}
@@ -0,0 +1,204 @@
+package cpu
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMonitorInvalid(t *testing.T) {
+	bound := func(v float64) func() float64 { return func() float64 { return v } }
+	cases := map[string][]Option{
+		"upper above one": {WithUpperBound(bound(1.2))},
+		"upper nan":       {WithUpperBound(bound(math.NaN()))},
+		"lower negative":  {WithLowerBound(bound(-0.1))},
+		"lower above":     {WithUpperBound(bound(0.5)), WithLowerBound(bound(0.6))},
+		"unknown alg":     {WithAlg(MonitorAlg(9))},
+		"zero score":      {WithThresholdScore(0)},
+	}
+	for name, ops := range cases {
+		monitor, err := NewMonitor(ops...)
+		assert.Error(t, err, name)
+		assert.Nil(t, monitor, name)
+	}
+}
+
+func TestNewCPUMonitorClamps(t *testing.T) {
+	monitor, err := NewMonitor(WithUpperBound(func() float64 { return 0.85 }), WithLowerBound(func() float64 { return 0.75 }))
+	assert.NoError(t, err)
+	monitor.(StoppableMonitor).Stop()
+
+	monitor = NewCPUMonitor(WithUpperBound(func() float64 { return 1.5 }), WithLowerBound(func() float64 { return math.NaN() }))
+	defer monitor.(StoppableMonitor).Stop()
+	state := monitor.(StateMonitor).State()
+	assert.Equal(t, 1.0, state.UpperThreshold)
+	assert.Equal(t, lowerThreshold, state.LowerThreshold)
+}
+
+func TestMonitorZScoreHysteresis(t *testing.T) {
+	bound := func(v float64) func() float64 { return func() float64 { return v } }
+	z := newMonitorZScore(testOptions(t, WithAlg(ZScore), WithUpperBound(bound(0.8)), WithLowerBound(bound(0.6)),
+		WithContinuousTimes(2, 1), WithEmergencyThreshold(0.95)))
+
+	z.confirm.decide(0.85, nil, nil)
+	z.confirm.decide(0.85, nil, nil)
+	assert.False(t, z.IsOverload())
+	z.confirm.decide(0.85, nil, nil)
+	assert.True(t, z.IsOverload())
+
+	z.decideLessLoad(0.5, nil, nil)
+	assert.True(t, z.IsOverload())
+	z.decideLessLoad(0.5, nil, nil)
+	assert.False(t, z.IsOverload())
+
+	// the emergency threshold skips the confirmation
+	z.confirm.decide(0.96, nil, nil)
+	assert.True(t, z.IsOverload())
+}
+
+func TestMonitorZScoreRing(t *testing.T) {
+	bound := func(v float64) func() float64 { return func() float64 { return v } }
+	// a flat usage above the upper bound used to be filtered out entirely by a zero standard deviation
+	source := &scriptedSource{usages: []float64{0.9, 0.9, 0.9, 0.9, 0, 0.5, 0.5, 0.5, 0.5, 0.5}}
+	z := newMonitorZScore(testOptions(t, WithAlg(ZScore), WithSource(source), WithUpperBound(bound(0.8)),
+		WithLowerBound(bound(0.7)), WithContinuousTimes(1, 1), WithEmergencyThreshold(2),
+		WithInterval(time.Second), WithWindow(4*time.Second, 4)))
+	assert.Equal(t, cpuCollectorSize, ringSize(testOptions(t)))
+	assert.Equal(t, 20, ringSize(testOptions(t, WithWindow(10*time.Second, 20))))
+	assert.Equal(t, 10, ringSize(testOptions(t, WithWindow(time.Second, 100))))
+
+	var got []bool
+	for range source.usages {
+		z.decide()
+		got = append(got, z.IsOverload())
+	}
+	// the missing usage is skipped, the ring of 4 is all 0.5 at the 9th decision
+	assert.Equal(t, []bool{false, true, true, true, true, true, true, true, false, false}, got)
+	assert.Equal(t, []float64{0.5, 0.5, 0.5, 0.5}, z.rates)
+}
+
+// constantSource returns the same usage on every call without allocating
+type constantSource float64
+
+func (s constantSource) Usage() float64 {
+	return float64(s)
+}
+
+func (s constantSource) Samples() []float64 {
+	return []float64{float64(s)}
+}
+
+func TestMonitorZScoreAllocs(t *testing.T) {
+	bound := func(v float64) func() float64 { return func() float64 { return v } }
+	z := newMonitorZScore(testOptions(t, WithAlg(ZScore), WithSource(constantSource(0.5)),
+		WithUpperBound(bound(0.8)), WithLowerBound(bound(0.7))))
+	// fill the ring and the reused slices first
+	for i := 0; i < ringSize(testOptions(t)); i++ {
+		z.decide()
+	}
+	assert.Equal(t, float64(0), testing.AllocsPerRun(100, z.decide))
+	assert.Len(t, z.rates, cpuCollectorSize)
+}
+
+func TestUsageWindow(t *testing.T) {
+	source := &scriptedSource{usages: []float64{0.1, 0, 0.2, 0.3, 0.4}}
+	opts := newOptions()
+	WithSource(source).f(opts)
+	WithWindow(time.Minute, 3).f(opts)
+	w := newUsageWindow(opts)
+	var samples []float64
+	for range source.usages {
+		samples = w.samples()
+	}
+	assert.InDeltaSlice(t, []float64{0.2, 0.3, 0.4}, samples, 1e-9)
+
+	for _, ops := range [][]Option{
+		{WithInterval(0)},
+		{WithWindow(time.Second, 0)},
+		{WithWait(-time.Second, time.Second)},
+		{WithEmergencyThreshold(math.NaN())},
+		{WithAlpha(0)},
+		{WithPercentile(1.5)},
+		{WithSource(nil)},
+	} {
+		_, err := NewMonitor(ops...)
+		assert.Error(t, err)
+	}
+}
+
+// testOptions applies ops to the defaults, the monitors built from them are not started
+func testOptions(t *testing.T, ops ...Option) *Options {
+	opts := newOptions()
+	for _, do := range ops {
+		do.f(opts)
+	}
+	assert.NoError(t, opts.validate())
+	return opts
+}
+
+// scriptedSource replays usages, one per call to Usage, and the windows, one per call to Samples
+type scriptedSource struct {
+	usages  []float64
+	windows [][]float64
+}
+
+func (s *scriptedSource) Usage() float64 {
+	if len(s.usages) == 0 {
+		return 0
+	}
+	usage := s.usages[0]
+	s.usages = s.usages[1:]
+	return usage
+}
+
+func (s *scriptedSource) Samples() []float64 {
+	if len(s.windows) == 0 {
+		return nil
+	}
+	window := s.windows[0]
+	s.windows = s.windows[1:]
+	return window
+}
+
+func TestMonitorStat(t *testing.T) {
+	bound := func(v float64) func() float64 { return func() float64 { return v } }
+	flat := func(v float64, n int) []float64 {
+		w := make([]float64, n)
+		for i := range w {
+			w[i] = v
+		}
+		return w
+	}
+	// a window mostly below the bound with a few spikes, skewed towards overload by its average only
+	spiky := append(flat(0.6, 17), 0.99, 0.99, 0.99)
+	cases := []struct {
+		name     string
+		opts     []Option
+		windows  [][]float64
+		overload []bool
+	}{
+		{"ewma follows the latest samples", []Option{WithAlg(EWMA), WithAlpha(0.5)},
+			[][]float64{append(flat(0.5, 5), 0.9, 0.9, 0.9), append(flat(0.5, 5), 0.9, 0.9, 0.9), flat(0.5, 8)},
+			[]bool{false, true, true}},
+		{"mad ignores spikes", []Option{WithAlg(MAD)},
+			[][]float64{spiky, spiky, spiky}, []bool{false, false, false}},
+		{"mad keeps a flat window", []Option{WithAlg(MAD)},
+			[][]float64{flat(0.9, 10), flat(0.9, 10)}, []bool{false, true}},
+		{"percentile", []Option{WithAlg(Percentile), WithPercentile(0.9)},
+			[][]float64{spiky, spiky, flat(0.5, 10), flat(0.5, 10)}, []bool{false, true, true, false}},
+	}
+	for _, c := range cases {
+		source := &scriptedSource{windows: c.windows}
+		opts := append([]Option{WithSource(source), WithUpperBound(bound(0.8)), WithLowerBound(bound(0.7)),
+			WithContinuousTimes(1, 1), WithEmergencyThreshold(2)}, c.opts...)
+		m := newMonitorStat(testOptions(t, opts...))
+		var got []bool
+		for range c.windows {
+			m.decide()
+			got = append(got, m.IsOverload())
+		}
+		assert.Equal(t, c.overload, got, c.name)
+	}
+}
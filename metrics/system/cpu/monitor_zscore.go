@@ -1,123 +1,109 @@
-/*
- * Copyright 2021 ByteDance Inc.
- *
- * Licensed under the Apache License, Version 2.0 (the "License");
- * you may not use this file except in compliance with the License.
- * You may obtain a copy of the License at
- *
- *     http://www.apache.org/licenses/LICENSE-2.0
- *
- * Unless required by applicable law or agreed to in writing, software
- * distributed under the License is distributed on an "AS IS" BASIS,
- * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
- * See the License for the specific language governing permissions and
- * limitations under the License.
- */
 package cpu
 
 import (
-	"log"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/bytedance/pid_limits/arithmetic/common"
 	"github.com/bytedance/pid_limits/arithmetic/zscore"
-	"github.com/bytedance/pid_limits/core/system"
 	"github.com/bytedance/pid_limits/util"
+	"github.com/bytedance/pid_limits/util/logging"
 )
 
 /**
 使用 zscore 判断CPU是否过载
 */
 
+// MonitorZScore adds the cpu usage of every decision to a ring, of the size of the own window or of the window of
+// the cpu collector, and decides on the average of the samples whose z-score is within score
 type MonitorZScore struct {
-	upperThreshold func() float64
-	lowerThreshold func() float64
-	score          float64
-	overload       atomic.Value
-	initOnce       sync.Once
-	continuousTime uint32 // 记录连续低于阈值的次数
+	confirm
+	score    float64
+	initOnce sync.Once
+	stopOnce sync.Once
+	stop     chan struct{}
+	interval time.Duration
+	source   Source
+	ring     *zscore.Ring
+	// rates and windows are reused by every decision
+	rates   []float64
+	windows []float64
 }
 
-const (
-	// 连续多少次超过【低于】阈值，则开启【关闭】限流
-	continuousTimes = uint32(30)
-)
-
 func NewMonitorZScore(opts *Options) Monitor {
+	monitor := newMonitorZScore(opts)
+	monitor.start()
+	return monitor
+}
+
+func newMonitorZScore(opts *Options) *MonitorZScore {
 	monitor := &MonitorZScore{
-		score:          opts.score,
-		upperThreshold: opts.upperThreshold,
-		lowerThreshold: opts.lowerThreshold,
-		overload:       atomic.Value{},
+		score:    opts.score,
+		stop:     make(chan struct{}),
+		interval: opts.interval,
+		source:   opts.source,
+		ring:     zscore.NewRing(ringSize(opts)),
 	}
-	monitor.overload.Store(false)
-	monitor.start()
+	monitor.confirm.init(opts)
 	return monitor
 }
 
 // IsOverload method used to output whether the cpu is overload with the statistical method - zscore
 func (monitor *MonitorZScore) IsOverload() bool {
 	if monitor == nil {
-		log.Println("error: adaptive cpu Monitor is nil")
+		logging.Error("adaptive cpu monitor is nil")
 		return false
 	}
-	if overload, ok := monitor.overload.Load().(bool); ok {
-		return overload
-	}
-	log.Println("error: adaptive failed to get overload information from Monitor")
-	return false
+	return monitor.confirm.IsOverload()
+}
+
+func (monitor *MonitorZScore) State() MonitorState {
+	return monitor.confirm.state(ZScore)
 }
 
 func (monitor *MonitorZScore) start() {
 	monitor.initOnce.Do(func() {
-		go util.LoopWithInterval(func() {
+		go util.LoopWithIntervalUntil(func() {
 			monitor.decide()
-		}, 100*time.Millisecond)
+		}, monitor.interval, monitor.stop)
+	})
+}
+
+// Stop ends the background goroutine, the overload flag is frozen
+func (monitor *MonitorZScore) Stop() {
+	monitor.stopOnce.Do(func() {
+		close(monitor.stop)
 	})
 }
 
 func (monitor *MonitorZScore) decide() {
 	if monitor == nil {
-		log.Println("error: cpu Monitor is nil")
+		logging.Error("cpu monitor is nil")
 		return
 	}
-	rateWindows := system.ExtractCPUWindows()
-	windows := zscore.ZScore(rateWindows, monitor.score)
-	if len(windows) == 0 {
-		return
+	if usage := monitor.source.Usage(); usage > 0 {
+		monitor.ring.Add(usage)
 	}
-	avgCPU := common.AverageFloat(windows)
-	if monitor.IsOverload() {
-		monitor.decideLessLoad(avgCPU, rateWindows, windows)
-	} else {
-		monitor.decideOverLoad(avgCPU, rateWindows, windows)
+	monitor.windows = monitor.ring.Filter(monitor.windows[:0], monitor.score)
+	if len(monitor.windows) == 0 {
+		return
 	}
+	monitor.rates = monitor.ring.Values(monitor.rates[:0])
+	monitor.confirm.decide(common.AverageFloat(monitor.windows), monitor.rates, monitor.windows)
 }
 
-func (monitor *MonitorZScore) decideOverLoad(avgCPU float64, rateWindows, windows []float64) {
-	// 在没有过载的时候，需要连续30个计算周期【3秒】中，每次CPU平均值高于阈值上限
-	// 如果 cpu 负载过高，可能导致协程无法100 ms 转一次，后续若干秒转一次
-	if avgCPU >= monitor.upperThreshold() && (atomic.AddUint32(&monitor.continuousTime, 1) > continuousTimes || avgCPU >= 0.99) {
-		log.Printf("warning: [adaptive limiting] start, rateWindows=%v windows=%v", rateWindows, windows)
-		monitor.overload.Store(true)
-		atomic.StoreUint32(&monitor.continuousTime, 0)
+// ringSize is the size of the own window, capped to the decisions within its length, or the capacity of the window
+// of the cpu collector without one
+func ringSize(opts *Options) int {
+	if opts.windowSize <= 0 {
+		return cpuCollectorSize
 	}
-
-	if avgCPU < monitor.lowerThreshold() {
-		atomic.StoreUint32(&monitor.continuousTime, 0)
-	}
-}
-
-func (monitor *MonitorZScore) decideLessLoad(avgCPU float64, rateWindows, windows []float64) {
-	if avgCPU < monitor.lowerThreshold() && atomic.AddUint32(&monitor.continuousTime, 1) > continuousTimes {
-		log.Printf("warning: [adaptive limiting] end, rateWindows=%v windows=%v", rateWindows, windows)
-		monitor.overload.Store(false)
-		atomic.StoreUint32(&monitor.continuousTime, 0)
+	size := opts.windowSize
+	if decisions := int(opts.windowLength / opts.interval); decisions < size {
+		size = decisions
 	}
-	if avgCPU >= monitor.upperThreshold() {
-		// 如果有一次阈值高于上限，都需要将其清零
-		atomic.StoreUint32(&monitor.continuousTime, 0)
+	if size < 2 {
+		return 2
 	}
+	return size
 }
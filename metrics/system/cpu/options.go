@@ -15,11 +15,32 @@
  */
 package  cpu
 
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
 const (
 	score = 2.4
 	threshold = 0.9
 	lowerThreshold = threshold * 0.9
 	alg = Raw
+	// 高于该值时不需要连续多次确认，立即开启限流
+	emergencyThreshold = 0.99
+	interval = 100 * time.Millisecond
+	defaultAlpha = 0.3
+	defaultPercentile = 0.5
+	defaultBeta = 0.3
+)
+
+const (
+	// DefaultContinuousTimes 连续多少次超过【低于】阈值，则开启【关闭】限流
+	DefaultContinuousTimes = uint32(30)
+	// DefaultWait is how long the Raw monitor confirms the start and the end of an overload
+	DefaultWait = 6 * time.Second
+	// DefaultHorizon is how far ahead the Forecast monitor projects the cpu usage
+	DefaultHorizon = 3 * time.Second
 )
 
 type MonitorAlg int
@@ -27,8 +48,56 @@ type MonitorAlg int
 const (
 	ZScore MonitorAlg = iota
 	Raw
+	// EWMA decides on the exponentially weighted moving average of the window
+	EWMA
+	// MAD decides on the average of the window without the outliers by median absolute deviation
+	MAD
+	// Percentile decides on a percentile of the window, the median by default
+	Percentile
+	// Forecast decides on the cpu usage projected ahead by the trend of the window
+	Forecast
 )
 
+var monitorAlgs = []MonitorAlg{ZScore, Raw, EWMA, MAD, Percentile, Forecast}
+
+// ParseMonitorAlg parses the name returned by MonitorAlg.String
+func ParseMonitorAlg(name string) (MonitorAlg, error) {
+	for _, alg := range monitorAlgs {
+		if alg.String() == name {
+			return alg, nil
+		}
+	}
+	return 0, fmt.Errorf("cpu: unknown monitor alg %q", name)
+}
+
+func (alg MonitorAlg) String() string {
+	switch alg {
+	case ZScore:
+		return "zscore"
+	case Raw:
+		return "raw"
+	case EWMA:
+		return "ewma"
+	case MAD:
+		return "mad"
+	case Percentile:
+		return "percentile"
+	case Forecast:
+		return "forecast"
+	}
+	return "unknown"
+}
+
+// Valid reports whether alg is one of the algorithms of this package
+func (alg MonitorAlg) Valid() bool {
+	for _, known := range monitorAlgs {
+		if alg == known {
+			return true
+		}
+	}
+	return false
+}
+
 // Option .
 type Option struct {
 	f func(*Options)
@@ -39,6 +108,21 @@ type Options struct {
 	lowerThreshold		func()float64
 	alg                 MonitorAlg
 	score               float64
+	overload            bool
+	enterTimes          uint32
+	exitTimes           uint32
+	emergency           float64
+	interval            time.Duration
+	enterWait           time.Duration
+	exitWait            time.Duration
+	windowLength        time.Duration
+	windowSize          int
+	source              Source
+	alpha               float64
+	percentile          float64
+	forecastModel       ForecastModel
+	horizon             time.Duration
+	beta                float64
 }
 
 func newOptions() *Options {
@@ -51,7 +135,69 @@ func newOptions() *Options {
 		},
 		alg:                 alg,
 		score:               score,
+		enterTimes:          DefaultContinuousTimes,
+		exitTimes:           DefaultContinuousTimes,
+		emergency:           emergencyThreshold,
+		interval:            interval,
+		enterWait:           DefaultWait,
+		exitWait:            DefaultWait,
+		source:              collectorSource{},
+		alpha:               defaultAlpha,
+		percentile:          defaultPercentile,
+		forecastModel:       ForecastLinear,
+		horizon:             DefaultHorizon,
+		beta:                defaultBeta,
+	}
+}
+
+func (o *Options) validate() error {
+	upper, lower := o.upperThreshold(), o.lowerThreshold()
+	if math.IsNaN(upper) || upper < 0 || upper > 1 {
+		return fmt.Errorf("cpu: upper threshold should be in 0 ~ 1, got %v", upper)
+	}
+	if math.IsNaN(lower) || lower < 0 || lower > 1 {
+		return fmt.Errorf("cpu: lower threshold should be in 0 ~ 1, got %v", lower)
 	}
+	if lower > upper {
+		return fmt.Errorf("cpu: lower threshold %v is above the upper threshold %v", lower, upper)
+	}
+	if !o.alg.Valid() {
+		return fmt.Errorf("cpu: unknown monitor alg %d", o.alg)
+	}
+	if !(o.score > 0) {
+		return fmt.Errorf("cpu: z-score should be > 0, got %v", o.score)
+	}
+	if !(o.emergency >= 0) {
+		return fmt.Errorf("cpu: emergency threshold should be >= 0, got %v", o.emergency)
+	}
+	if !(o.alpha > 0 && o.alpha <= 1) {
+		return fmt.Errorf("cpu: alpha should be in (0, 1], got %v", o.alpha)
+	}
+	if !(o.percentile >= 0 && o.percentile <= 1) {
+		return fmt.Errorf("cpu: percentile should be in [0, 1], got %v", o.percentile)
+	}
+	if o.forecastModel != ForecastLinear && o.forecastModel != ForecastHolt {
+		return fmt.Errorf("cpu: unknown forecast model %d", o.forecastModel)
+	}
+	if o.horizon < 0 {
+		return fmt.Errorf("cpu: horizon should be >= 0, got %v", o.horizon)
+	}
+	if !(o.beta > 0 && o.beta <= 1) {
+		return fmt.Errorf("cpu: beta should be in (0, 1], got %v", o.beta)
+	}
+	if o.source == nil {
+		return fmt.Errorf("cpu: source should not be nil")
+	}
+	if o.interval <= 0 {
+		return fmt.Errorf("cpu: interval should be > 0, got %v", o.interval)
+	}
+	if o.enterWait < 0 || o.exitWait < 0 {
+		return fmt.Errorf("cpu: waits should be >= 0, got %v and %v", o.enterWait, o.exitWait)
+	}
+	if o.windowSize < 0 || o.windowLength < 0 || (o.windowSize == 0) != (o.windowLength == 0) {
+		return fmt.Errorf("cpu: window length and size should both be > 0 or both 0, got %v and %d", o.windowLength, o.windowSize)
+	}
+	return nil
 }
 
 // WithThresholdScore is used to set z-score critical value
@@ -75,9 +221,96 @@ func WithLowerBound(value func()float64) Option {
 	}}
 }
 
+// WithInitialOverload starts the monitor in the given overload state, eg. to replace a running monitor
+func WithInitialOverload(overload bool) Option {
+	return Option{f: func(options *Options) {
+		options.overload = overload
+	}}
+}
+
 // WithAlg is used to set algorithm for the overload decision
 func WithAlg(alg MonitorAlg) Option {
 	return Option{f: func(options *Options) {
 		options.alg = alg
 	}}
-}
\ No newline at end of file
+}
+// WithContinuousTimes sets how many consecutive decisions above the upper bound start the overload, and below the
+// lower bound end it, 30 by default. It is used by ZScore
+func WithContinuousTimes(enter, exit uint32) Option {
+	return Option{f: func(options *Options) {
+		options.enterTimes = enter
+		options.exitTimes = exit
+	}}
+}
+
+// WithEmergencyThreshold sets the cpu usage starting the overload without waiting for the consecutive decisions,
+// 0.99 by default, a value above 1 disables it. It is used by ZScore
+func WithEmergencyThreshold(emergency float64) Option {
+	return Option{f: func(options *Options) {
+		options.emergency = emergency
+	}}
+}
+
+// WithInterval sets how often the monitor decides, 100ms by default
+func WithInterval(interval time.Duration) Option {
+	return Option{f: func(options *Options) {
+		options.interval = interval
+	}}
+}
+
+// WithWait sets how long the cpu usage is confirmed above the upper bound to start the overload, and below the lower
+// bound to end it, 6s by default. It is used by Raw
+func WithWait(enter, exit time.Duration) Option {
+	return Option{f: func(options *Options) {
+		options.enterWait = enter
+		options.exitWait = exit
+	}}
+}
+
+// WithWindow makes the monitor keep its own window of the size last samples within length, taken at each decision,
+// instead of the window of the cpu collector, 100 samples within 6s. ZScore keeps the usage of its decisions in a ring
+// of size, capped to the decisions within length, or of 100 decisions without it
+func WithWindow(length time.Duration, size int) Option {
+	return Option{f: func(options *Options) {
+		options.windowLength = length
+		options.windowSize = size
+	}}
+}
+
+// WithSource makes the monitor decide on the cpu usage of source instead of the cpu collector, eg. to replay a trace
+func WithSource(source Source) Option {
+	return Option{f: func(options *Options) {
+		options.source = source
+	}}
+}
+
+// WithAlpha sets the weight of the latest sample in the EWMA monitor and in the level of the Holt forecast,
+// 0.3 by default
+func WithAlpha(alpha float64) Option {
+	return Option{f: func(options *Options) {
+		options.alpha = alpha
+	}}
+}
+
+// WithPercentile sets the percentile, 0 ~ 1, of the window the Percentile monitor decides on, 0.5 by default
+func WithPercentile(percentile float64) Option {
+	return Option{f: func(options *Options) {
+		options.percentile = percentile
+	}}
+}
+
+// WithForecast sets the trend fitted by the Forecast monitor and how far ahead it projects the cpu usage,
+// ForecastLinear and 3s by default
+func WithForecast(model ForecastModel, horizon time.Duration) Option {
+	return Option{f: func(options *Options) {
+		options.forecastModel = model
+		options.horizon = horizon
+	}}
+}
+
+// WithBeta sets the weight of the latest change in the trend of the Holt forecast, 0.3 by default
+func WithBeta(beta float64) Option {
+	return Option{f: func(options *Options) {
+		options.beta = beta
+	}}
+}
@@ -0,0 +1,100 @@
+package cpu
+
+import (
+	"time"
+
+	"github.com/bytedance/pid_limits/core/stat"
+	"github.com/bytedance/pid_limits/core/system"
+)
+
+const windowScale float64 = 10000000
+
+// Source provides the cpu usage the monitors decide on, the cpu collector by default
+type Source interface {
+	// Usage is the current cpu usage
+	Usage() float64
+	// Samples are the recent cpu usages in order of time
+	Samples() []float64
+}
+
+// TimedSource is implemented by sources whose samples carry the unix milliseconds they were taken at,
+// the Forecast monitor fits its trend on the times instead of assuming evenly spaced samples
+type TimedSource interface {
+	TimedSamples() (timestamps []int64, usages []float64)
+}
+
+type collectorSource struct{}
+
+func (collectorSource) Usage() float64 {
+	return system.CurrentCPUUsage()
+}
+
+func (collectorSource) Samples() []float64 {
+	return system.ExtractCPUWindows()
+}
+
+func (collectorSource) TimedSamples() ([]int64, []float64) {
+	return system.ExtractCPUSamples()
+}
+
+// usageWindow is the window of cpu usage samples a monitor decides on, the samples of the source when own is nil
+type usageWindow struct {
+	source Source
+	own    *stat.SlidingWindow
+}
+
+func newUsageWindow(opts *Options) usageWindow {
+	if opts.windowSize <= 0 {
+		return usageWindow{source: opts.source}
+	}
+	return usageWindow{source: opts.source, own: stat.NewSlidingWindow(opts.windowSize, opts.windowLength)}
+}
+
+// samples records the usage of this decision in the own window and returns the samples in order of time
+func (w usageWindow) samples() []float64 {
+	if w.own == nil {
+		return w.source.Samples()
+	}
+	if usage := w.source.Usage(); usage > 0 {
+		w.own.Add(int(usage * windowScale))
+	}
+	var samples []float64
+	for _, v := range w.own.GetData() {
+		if v == 0 {
+			continue
+		}
+		samples = append(samples, float64(v)/windowScale)
+	}
+	return samples
+}
+
+// timedSamples is samples with the time of every sample in seconds relative to the last one. The times come from
+// the own window or a TimedSource, the samples of other sources are taken to be step apart
+func (w usageWindow) timedSamples(step time.Duration) (times []float64, samples []float64) {
+	var timestamps []int64
+	if w.own != nil {
+		if usage := w.source.Usage(); usage > 0 {
+			w.own.Add(int(usage * windowScale))
+		}
+		for _, point := range w.own.GetDataPoints() {
+			if point.Value == 0 {
+				continue
+			}
+			timestamps = append(timestamps, point.Timestamp)
+			samples = append(samples, float64(point.Value)/windowScale)
+		}
+	} else if source, ok := w.source.(TimedSource); ok {
+		timestamps, samples = source.TimedSamples()
+	} else {
+		samples = w.source.Samples()
+	}
+	times = make([]float64, len(samples))
+	for i := range samples {
+		if timestamps != nil {
+			times[i] = float64(timestamps[i]-timestamps[len(timestamps)-1]) / 1000
+		} else {
+			times[i] = float64(i-len(samples)+1) * step.Seconds()
+		}
+	}
+	return times, samples
+}
@@ -15,6 +15,8 @@
  */
 package  plato
 
+import "time"
+
 //Chain will return cached value of target metric. It return 0 when input PlatoEntry does not have target metric, or input PlatoEntry has not been pass to plato.Init method
 func Chain(entry *PlatoEntry, metricType MetricFactory) float64 {
 	m := entry.Metrics[metricType]
@@ -36,3 +38,9 @@ func Calculate(entry *PlatoEntry, metricType MetricFactory) float64 {
 type RuleInterface interface {
 	Decide(ctx *EntryCtx) bool
 }
+
+//ExitListener can be implemented by a RuleInterface that needs to observe admitted requests finishing, eg. to track in-flight count and rtt.
+//OnExit is called by PlatoEntry.Exit with the rtt measured by the monotonic clock, precise below a millisecond
+type ExitListener interface {
+	OnExit(ctx *EntryCtx, rtt time.Duration)
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package plato
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/bytedance/pid_limits/core/base"
+	"github.com/bytedance/pid_limits/util"
+)
+
+var (
+	ErrRejectByThrottle = errors.New("reject by client throttle")
+)
+
+//Throttle is the client side adaptive throttling described in the Google SRE book.
+//It tracks requests versus accepts of a dependency with a PlatoEntry and rejects locally with probability
+//max(0, (requests - K*accepts) / (requests + 1)), so an overloaded dependency is not hammered by retries.
+//It protects the dependency rather than this process and is not affected by the kill switch of package limiting
+type Throttle struct {
+	entry    *PlatoEntry
+	k        float64
+	rejected func(error) bool
+	rand     func() float64
+}
+
+type throttleOptions struct {
+	k        float64
+	window   time.Duration
+	now      func() time.Time
+	rejected func(error) bool
+}
+
+type ThrottleOption func(*throttleOptions)
+
+//WithThrottleK sets the multiplier K, a lower K throttles more aggressively, 2 is recommended
+func WithThrottleK(k float64) ThrottleOption {
+	return func(options *throttleOptions) {
+		options.k = k
+	}
+}
+
+//WithThrottleWindow sets the window the requests and accepts are counted in
+func WithThrottleWindow(window time.Duration) ThrottleOption {
+	return func(options *throttleOptions) {
+		options.window = window
+	}
+}
+
+//WithThrottleClock sets the clock of the windows, used in tests
+func WithThrottleClock(now func() time.Time) ThrottleOption {
+	return func(options *throttleOptions) {
+		options.now = now
+	}
+}
+
+//WithThrottleRejected decides whether an error returned to Do means the dependency did not accept the request,
+//by default every error but context.Canceled does
+func WithThrottleRejected(f func(error) bool) ThrottleOption {
+	return func(options *throttleOptions) {
+		options.rejected = f
+	}
+}
+
+func NewThrottle(name string, opts ...ThrottleOption) *Throttle {
+	options := &throttleOptions{
+		k:      2,
+		window: time.Millisecond * time.Duration(base.DefaultIntervalMs),
+		now:    time.Now,
+		rejected: func(err error) bool {
+			return err != nil && !errors.Is(err, context.Canceled)
+		},
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	t := &Throttle{
+		entry:    newPlatoEntry(name, options.window, options.now),
+		k:        options.k,
+		rejected: options.rejected,
+		rand: func() float64 {
+			return float64(util.Uint32()) / math.MaxUint32
+		},
+	}
+	t.entry.Rule = t
+	return t
+}
+
+//Entry returns the PlatoEntry of the throttle, it can be passed to plato.Init to calculate its metrics
+func (t *Throttle) Entry() *PlatoEntry {
+	return t.entry
+}
+
+//RejectProbability returns the current local reject probability, 0 ~ 1
+func (t *Throttle) RejectProbability() float64 {
+	completion := float64(t.entry.completion.GetSum())
+	requests := completion + float64(t.entry.blocked.GetSum())
+	accepts := completion - float64(t.entry.error.GetSum())
+	return math.Max(0, (requests-t.k*accepts)/(requests+1))
+}
+
+//Decide implements RuleInterface
+func (t *Throttle) Decide(ctx *EntryCtx) bool {
+	p := t.RejectProbability()
+	return p == 0 || t.rand() >= p
+}
+
+//Do runs f unless it is rejected locally, ErrRejectByThrottle is returned in that case
+func (t *Throttle) Do(f func() error) error {
+	ctx, ok := t.entry.Entry()
+	if !ok {
+		return ErrRejectByThrottle
+	}
+	err := f()
+	t.entry.Exit(ctx)
+	if t.rejected(err) {
+		t.entry.ReportError(err)
+	}
+	return err
+}
+
+//RoundTripper wraps next, transport errors and 429 or 503 responses count as not accepted.
+//Requests canceled by the caller are not held against the dependency, and the body of a request rejected
+//locally is closed as the http.RoundTripper contract requires
+func (t *Throttle) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &throttleRoundTripper{t: t, next: next}
+}
+
+type throttleRoundTripper struct {
+	t    *Throttle
+	next http.RoundTripper
+}
+
+func (rt *throttleRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, ok := rt.t.entry.Entry()
+	if !ok {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, ErrRejectByThrottle
+	}
+	resp, err := rt.next.RoundTrip(req)
+	rt.t.entry.Exit(ctx)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) && !errors.Is(req.Context().Err(), context.Canceled) {
+			rt.t.entry.ReportError(err)
+		}
+	} else if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		rt.t.entry.ReportError(nil)
+	}
+	return resp, err
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package plato
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottle(t *testing.T) {
+	now := time.UnixMilli(1000000)
+	throttle := NewThrottle("dependency", WithThrottleClock(func() time.Time { return now }), WithThrottleWindow(time.Second))
+	throttle.rand = func() float64 { return 0.5 }
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, throttle.Do(func() error { return nil }))
+	}
+	assert.Equal(t, float64(0), throttle.RejectProbability())
+
+	// 10 requests, 10 accepts, 30 rejected by the dependency: (40 - 2*10) / 41
+	for i := 0; i < 30; i++ {
+		_ = throttle.Do(func() error { return errors.New("overload") })
+	}
+	assert.InDelta(t, 20.0/41, throttle.RejectProbability(), 1e-9)
+	assert.True(t, throttle.Decide(nil))
+
+	for i := 0; i < 10; i++ {
+		_ = throttle.Do(func() error { return errors.New("overload") })
+	}
+	assert.Equal(t, ErrRejectByThrottle, throttle.Do(func() error { return nil }))
+
+	// the window expired, everything is admitted again
+	now = now.Add(2 * time.Second)
+	assert.Equal(t, float64(0), throttle.RejectProbability())
+	assert.Nil(t, throttle.Do(func() error { return nil }))
+}
+
+func TestThrottleRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	throttle := NewThrottle("server", WithThrottleK(1))
+	throttle.rand = func() float64 { return 0.99 }
+	client := &http.Client{Transport: throttle.RoundTripper(nil)}
+	for i := 0; i < 200; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			assert.True(t, errors.Is(err, ErrRejectByThrottle))
+			return
+		}
+		_ = resp.Body.Close()
+	}
+	t.Fatal("the overloaded server is never throttled")
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type closeBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestThrottleRoundTripperCanceled(t *testing.T) {
+	now := time.UnixMilli(1000000)
+	throttle := NewThrottle("dependency", WithThrottleClock(func() time.Time { return now }), WithThrottleWindow(time.Second))
+	rt := throttle.RoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		now = now.Add(500 * time.Microsecond)
+		return nil, req.Context().Err()
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://dependency", nil)
+		_, err := rt.RoundTrip(req)
+		assert.True(t, errors.Is(err, context.Canceled))
+	}
+	// canceled requests are not held against the dependency
+	assert.Equal(t, float64(0), throttle.RejectProbability())
+	assert.Equal(t, context.Canceled, throttle.Do(func() error { return context.Canceled }))
+	assert.Equal(t, 0, throttle.entry.error.GetSum())
+}
+
+func TestThrottleRoundTripperRejectClosesBody(t *testing.T) {
+	throttle := NewThrottle("dependency")
+	throttle.rand = func() float64 { return 0 }
+	rt := throttle.RoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("unreachable")
+	}))
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequest(http.MethodPost, "http://dependency", nil)
+		_, _ = rt.RoundTrip(req)
+	}
+
+	body := &closeBody{Reader: strings.NewReader("payload")}
+	req, _ := http.NewRequest(http.MethodPost, "http://dependency", body)
+	_, err := rt.RoundTrip(req)
+	assert.Equal(t, ErrRejectByThrottle, err)
+	assert.True(t, body.closed)
+}
+
+func TestThrottleClock(t *testing.T) {
+	now := time.UnixMilli(1000000)
+	throttle := NewThrottle("dependency", WithThrottleClock(func() time.Time { return now }), WithThrottleWindow(time.Second))
+	ctx, ok := throttle.entry.Entry()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1000000), ctx.GetStartTime())
+	now = now.Add(3 * time.Millisecond)
+	assert.Equal(t, 3*time.Millisecond, ctx.Elapsed())
+	throttle.entry.Exit(ctx)
+	assert.Equal(t, 3, throttle.entry.rtt.GetSum())
+}
@@ -17,10 +17,11 @@ package  executors
 
 import (
 	"errors"
-	"log"
 	"runtime"
 	"runtime/debug"
 	"sync/atomic"
+
+	"github.com/bytedance/pid_limits/util/logging"
 )
 
 type executorsMsg struct {
@@ -120,7 +121,7 @@ func (f *fixedSizeExecutorsPool) loop() {
 				var m executorsMsg
 				defer func() {
 					if e := recover(); e != nil {
-						log.Printf("error: executors panic : error %v, stack : %v", e, string(debug.Stack()))
+						logging.Error("executors panic", "err", e, "stack", string(debug.Stack()))
 						if m.f != nil {
 							m.f.Done(nil, errors.New("panic occur"))
 						}
@@ -0,0 +1,197 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package logging
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	// LevelOff disables every log line
+	LevelOff
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "off"
+}
+
+// ParseLevel parses the name returned by Level.String
+func ParseLevel(name string) (Level, error) {
+	for _, level := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError, LevelOff} {
+		if level.String() == strings.ToLower(name) {
+			return level, nil
+		}
+	}
+	return LevelOff, fmt.Errorf("logging: unknown level %q", name)
+}
+
+// Logger is a leveled key/value logger, kv is a list of alternating keys and values,
+// eg. logger.Warn("overload started", "cpu", 0.92, "ratio", 3000)
+type Logger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
+}
+
+// StdLogger writes "level msg k=v ..." lines to a standard logger, lines below its level are dropped
+type StdLogger struct {
+	logger *log.Logger
+	level  int32
+}
+
+// NewStdLogger returns a StdLogger writing to logger, the standard logger is used if logger is nil
+func NewStdLogger(logger *log.Logger, level Level) *StdLogger {
+	return &StdLogger{logger: logger, level: int32(level)}
+}
+
+func (l *StdLogger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+func (l *StdLogger) Enabled(level Level) bool {
+	return level >= Level(atomic.LoadInt32(&l.level))
+}
+
+func (l *StdLogger) Debug(msg string, kv ...interface{}) {
+	l.log(LevelDebug, msg, kv)
+}
+
+func (l *StdLogger) Info(msg string, kv ...interface{}) {
+	l.log(LevelInfo, msg, kv)
+}
+
+func (l *StdLogger) Warn(msg string, kv ...interface{}) {
+	l.log(LevelWarn, msg, kv)
+}
+
+func (l *StdLogger) Error(msg string, kv ...interface{}) {
+	l.log(LevelError, msg, kv)
+}
+
+func (l *StdLogger) log(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	line := Format(level, msg, kv...)
+	if l.logger == nil {
+		_ = log.Output(3, line)
+		return
+	}
+	_ = l.logger.Output(3, line)
+}
+
+// Format renders a log line as "level msg k1=v1 k2=v2", a trailing key without value is rendered as "k=<missing>"
+func Format(level Level, msg string, kv ...interface{}) string {
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteString(": ")
+	b.WriteString(msg)
+	for i := 0; i < len(kv); i += 2 {
+		b.WriteByte(' ')
+		fmt.Fprint(&b, kv[i])
+		b.WriteByte('=')
+		if i+1 < len(kv) {
+			fmt.Fprintf(&b, "%+v", kv[i+1])
+		} else {
+			b.WriteString("<missing>")
+		}
+	}
+	return b.String()
+}
+
+type nop struct{}
+
+func (nop) Debug(string, ...interface{}) {}
+func (nop) Info(string, ...interface{})  {}
+func (nop) Warn(string, ...interface{})  {}
+func (nop) Error(string, ...interface{}) {}
+
+// Nop returns a Logger discarding everything
+func Nop() Logger {
+	return nop{}
+}
+
+type holder struct {
+	logger Logger
+}
+
+var global atomic.Value
+
+// EnvLevel sets the level of the global logger, one of the names returned by Level.String
+const EnvLevel = "PLATO_LOG_LEVEL"
+
+func init() {
+	logger := NewStdLogger(nil, LevelInfo)
+	global.Store(holder{logger: logger})
+	if name := os.Getenv(EnvLevel); name != "" {
+		level, err := ParseLevel(name)
+		if err != nil {
+			logger.Warn("ignore invalid environment variable", "name", EnvLevel, "err", err)
+			return
+		}
+		logger.SetLevel(level)
+	}
+}
+
+// SetLogger replaces the global logger used by every component without a logger of its own, nil disables logging
+func SetLogger(logger Logger) {
+	if logger == nil {
+		logger = Nop()
+	}
+	global.Store(holder{logger: logger})
+}
+
+// Default returns the global logger, it writes info and above to the standard logger unless replaced by SetLogger
+func Default() Logger {
+	return global.Load().(holder).logger
+}
+
+func Debug(msg string, kv ...interface{}) {
+	Default().Debug(msg, kv...)
+}
+
+func Info(msg string, kv ...interface{}) {
+	Default().Info(msg, kv...)
+}
+
+func Warn(msg string, kv ...interface{}) {
+	Default().Warn(msg, kv...)
+}
+
+func Error(msg string, kv ...interface{}) {
+	Default().Error(msg, kv...)
+}
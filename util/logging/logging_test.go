@@ -0,0 +1,67 @@
+/*
+ * Copyright 2021 ByteDance Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "warn: overload started cpu=0.92 err=boom", Format(LevelWarn, "overload started", "cpu", 0.92, "err", errors.New("boom")))
+	assert.Equal(t, "info: msg k=<missing>", Format(LevelInfo, "msg", "k"))
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0), LevelWarn)
+	l.Info("dropped")
+	l.Warn("kept", "k", 1)
+	assert.Equal(t, "warn: kept k=1\n", buf.String())
+
+	buf.Reset()
+	l.SetLevel(LevelOff)
+	l.Error("dropped")
+	assert.Equal(t, "", buf.String())
+}
+
+func TestSetLogger(t *testing.T) {
+	defer SetLogger(Default())
+	var buf bytes.Buffer
+	SetLogger(NewStdLogger(log.New(&buf, "", 0), LevelDebug))
+	Debug("debug", "k", "v")
+	assert.Equal(t, "debug: debug k=v\n", buf.String())
+
+	SetLogger(nil)
+	assert.Equal(t, Nop(), Default())
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, level := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError, LevelOff} {
+		parsed, err := ParseLevel(level.String())
+		assert.NoError(t, err)
+		assert.Equal(t, level, parsed)
+	}
+	level, err := ParseLevel("WARN")
+	assert.NoError(t, err)
+	assert.Equal(t, LevelWarn, level)
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
@@ -16,7 +16,6 @@
 package  util
 
 import (
-	"log"
 	"math"
 	"os"
 	"reflect"
@@ -25,6 +24,8 @@ import (
 	"sync/atomic"
 	"time"
 	"unsafe"
+
+	"github.com/bytedance/pid_limits/util/logging"
 )
 
 const (
@@ -64,17 +65,37 @@ func CurrentTimeNano() uint64 {
 }
 
 func LoopWithInterval(runnable func(), interval time.Duration) {
+	LoopWithIntervalUntil(runnable, interval, nil)
+}
+
+// LoopWithIntervalUntil is LoopWithInterval returning once stop is closed, a nil stop never returns
+func LoopWithIntervalUntil(runnable func(), interval time.Duration, stop <-chan struct{}) {
 	funcName := runtime.FuncForPC(reflect.ValueOf(runnable).Pointer()).Name()
 	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
 		func() {
 			defer func() {
 				if err := recover(); err != nil {
-					log.Printf("error: [LoopWithInterval]%v(adaptive) panic, error : %v, stack : %s", funcName, err, debug.Stack())
+					logging.Error("LoopWithInterval panic", "func", funcName, "err", err, "stack", string(debug.Stack()))
 				}
 			}()
 			runnable()
 		}()
-		time.Sleep(interval)
+		if stop == nil {
+			time.Sleep(interval)
+			continue
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
 	}
 }
 
@@ -16,6 +16,7 @@
 package  util
 
 import (
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -173,3 +174,25 @@ func TestIsDocker(t *testing.T) {
 		})
 	}
 }
+
+func TestLoopWithIntervalUntil(t *testing.T) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	var n int32
+	go func() {
+		LoopWithIntervalUntil(func() {
+			if atomic.AddInt32(&n, 1) == 3 {
+				close(stop)
+			}
+		}, time.Millisecond, stop)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("LoopWithIntervalUntil did not return after stop")
+	}
+	if got := atomic.LoadInt32(&n); got != 3 {
+		t.Errorf("LoopWithIntervalUntil ran %d times, want 3", got)
+	}
+}